@@ -0,0 +1,411 @@
+package cropper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// BatchItem is one input image of a batch run
+type BatchItem struct {
+	// Input is the image path, relative paths are resolved against BatchOptions.InputDir
+	Input string `json:"input"`
+	// Faces are optional face rectangles in displayed image coordinates
+	Faces []Rect `json:"faces,omitempty"`
+}
+
+// BatchOptions configure a batch run
+type BatchOptions struct {
+	// Sizes are the target sizes written for every input
+	Sizes []SizeSpec
+	// InputDir is the directory relative inputs are read from
+	InputDir string
+	// OutputDir receives one sub directory per size mirroring the relative input paths.
+	// Outputs keep the input file name and only get the output extension appended when
+	// the input extension does not match the output format, e.g. a.bmp becomes a.bmp.jpg.
+	OutputDir string
+	// Workers is the number of images processed concurrently, at least one
+	Workers int
+	// Encoder configures the output files, an empty Format keeps the input format when it
+	// can be encoded and writes JPEG otherwise
+	Encoder EncoderOptions
+	// Options are passed to the analyzer for every image, Faces are taken from the items
+	Options Options
+	// Results is the path of the JSONL results manifest. Inputs already recorded there
+	// without an error are skipped, new results get appended so a run can be resumed.
+	Results string
+	// Progress, when set, is called for every result in the order they get recorded
+	Progress func(BatchResult)
+}
+
+// BatchResult is one line of the results manifest
+type BatchResult struct {
+	Input  string  `json:"input"`
+	Size   string  `json:"size"`
+	Output string  `json:"output,omitempty"`
+	Crop   *Report `json:"crop,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// BatchSummary counts the outcomes of a batch run per input and size
+type BatchSummary struct {
+	Processed int
+	Skipped   int
+	Failed    int
+}
+
+// imageExtensions are the file extensions picked up by WalkImages
+var imageExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".bmp": true, ".tif": true, ".tiff": true, ".webp": true,
+}
+
+// WalkImages returns the images below dir as batch items with paths relative to dir, the
+// directory skip (usually the output directory of the batch) is left out
+func WalkImages(dir, skip string) ([]BatchItem, error) {
+	var items []BatchItem
+	if skip != "" {
+		var err error
+		if skip, err = filepath.Abs(skip); err != nil {
+			return nil, err
+		}
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if abs, err := filepath.Abs(path); err == nil && abs == skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		items = append(items, BatchItem{Input: rel})
+		return nil
+	})
+	return items, err
+}
+
+// ReadBatchManifest reads batch items from JSONL, one BatchItem per line, blank lines are ignored
+func ReadBatchManifest(r io.Reader) ([]BatchItem, error) {
+	var items []BatchItem
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item BatchItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// Batch crops every item to every size in opts.Sizes across opts.Workers goroutines sharing
+// analyzer, which also decodes and writes the images when it implements Codec. Errors of
+// single images are recorded in the results and counted as failed, only failures to read or
+// write the results manifest and inputs that would write the same outputs abort the run.
+func Batch(analyzer Analyzer, items []BatchItem, opts BatchOptions) (BatchSummary, error) {
+	var summary BatchSummary
+	if err := batchCollisions(items, opts.InputDir); err != nil {
+		return summary, err
+	}
+	codec, ok := analyzer.(Codec)
+	if !ok {
+		codec = NewCodec(Config{})
+	}
+
+	done, err := readBatchResults(opts.Results)
+	if err != nil {
+		return summary, err
+	}
+	var manifest *os.File
+	if opts.Results != "" {
+		manifest, err = openBatchResults(opts.Results)
+		if err != nil {
+			return summary, err
+		}
+		defer manifest.Close()
+	}
+
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan BatchItem)
+	results := make(chan BatchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				batchItem(analyzer, codec, item, done, opts, results)
+			}
+		}()
+	}
+	go func() {
+		for _, item := range items {
+			jobs <- item
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	var writeErr error
+	var enc *json.Encoder
+	if manifest != nil {
+		enc = json.NewEncoder(manifest)
+	}
+	for res := range results {
+		switch {
+		case res.Output == "" && res.Error == "":
+			summary.Skipped++
+			continue
+		case res.Error != "":
+			summary.Failed++
+		default:
+			summary.Processed++
+		}
+		if enc != nil && writeErr == nil {
+			writeErr = enc.Encode(res)
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+
+	return summary, writeErr
+}
+
+// batchItem processes all sizes of item not yet done and sends one result per size, results
+// without output and error mark skipped sizes
+func batchItem(analyzer Analyzer, codec Codec, item BatchItem, done map[string]bool, opts BatchOptions, results chan<- BatchResult) {
+	var pending []SizeSpec
+	for _, size := range opts.Sizes {
+		if done[batchKey(item.Input, size.String())] {
+			results <- BatchResult{Input: item.Input, Size: size.String()}
+			continue
+		}
+		pending = append(pending, size)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	fail := func(err error) {
+		for _, size := range pending {
+			results <- BatchResult{Input: item.Input, Size: size.String(), Error: err.Error()}
+		}
+	}
+
+	path := item.Input
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(opts.InputDir, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fail(err)
+		return
+	}
+	img, format, err := codec.Decode(bytes.NewReader(data))
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	encOpts := opts.Encoder
+	if encOpts.Format == "" {
+		encOpts.Format = "jpeg"
+		if format == "png" || format == "gif" {
+			encOpts.Format = format
+		}
+	}
+	enc, err := NewEncoder(encOpts)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	analyzeOpts := opts.Options
+	analyzeOpts.Faces = nil
+	for _, f := range item.Faces {
+		analyzeOpts.Faces = append(analyzeOpts.Faces, f.Rectangle())
+	}
+
+	for _, size := range pending {
+		res := BatchResult{Input: item.Input, Size: size.String()}
+		output := batchOutput(item.Input, size, enc.Format(), opts.InputDir, opts.OutputDir)
+		report, err := batchWrite(analyzer, codec, img, size, analyzeOpts, enc, output)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			report.Format = format
+			res.Output, res.Crop = output, &report
+		}
+		results <- res
+	}
+}
+
+// batchWrite crops img to size and writes it to output
+func batchWrite(analyzer Analyzer, codec Codec, img image.Image, size SizeSpec, opts Options, enc Encoder, output string) (Report, error) {
+	res, err := analyzer.AnalyzeSize(img, size, opts)
+	if err != nil {
+		return Report{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return Report{}, err
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return Report{}, err
+	}
+	err = codec.WriteResult(f, img, res, enc)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return Report{}, err
+	}
+	return res.Report(), nil
+}
+
+// batchOutput returns the output path for input at size
+func batchOutput(input string, size SizeSpec, format, inputDir, dir string) string {
+	rel := batchName(input, inputDir)
+	ext := strings.ToLower(filepath.Ext(rel))
+	if !(ext == "."+format || format == "jpeg" && (ext == ".jpg" || ext == ".jpeg")) {
+		if format == "jpeg" {
+			format = "jpg"
+		}
+		rel += "." + format
+	}
+	return filepath.Join(dir, sizeDir(size), rel)
+}
+
+// batchName returns the path of input below the size directories, inputs outside of
+// inputDir keep only their base name
+func batchName(input, inputDir string) string {
+	rel := filepath.Clean(input)
+	if filepath.IsAbs(rel) && inputDir != "" {
+		if dir, err := filepath.Abs(inputDir); err == nil {
+			if r, err := filepath.Rel(dir, rel); err == nil {
+				rel = r
+			}
+		}
+	}
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = filepath.Base(rel)
+	}
+	return rel
+}
+
+// batchCollisions returns an error if two items could be written to the same output, either
+// because an input is listed twice, because they share a name below the size directories or
+// because one name is another with an output extension appended
+func batchCollisions(items []BatchItem, inputDir string) error {
+	names := make(map[string]string, len(items))
+	for _, item := range items {
+		name := batchName(item.Input, inputDir)
+		if other, ok := names[name]; ok {
+			if other == item.Input {
+				return fmt.Errorf("batch input %q is listed twice", item.Input)
+			}
+			return fmt.Errorf("batch inputs %q and %q have the same output", other, item.Input)
+		}
+		names[name] = item.Input
+	}
+	for name, input := range names {
+		for _, ext := range []string{".jpg", ".png", ".gif"} {
+			if other, ok := names[name+ext]; ok {
+				return fmt.Errorf("batch inputs %q and %q may have the same output", input, other)
+			}
+		}
+	}
+	return nil
+}
+
+// sizeDir returns a directory name for size that is safe on common file systems
+func sizeDir(size SizeSpec) string {
+	return strings.NewReplacer(":", "-", ">", "-max", "%", "pct").Replace(size.String())
+}
+
+// readBatchResults returns the input and size keys recorded without error in the results
+// manifest at path, a missing manifest has no results
+func readBatchResults(path string) (map[string]bool, error) {
+	done := map[string]bool{}
+	if path == "" {
+		return done, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var res BatchResult
+		// a run that got killed may leave a truncated last line behind
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			continue
+		}
+		if res.Error == "" && res.Output != "" {
+			done[batchKey(res.Input, res.Size)] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+// openBatchResults opens the results manifest at path for appending, a truncated last line
+// left by an interrupted run gets terminated first
+func openBatchResults(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return f, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if last[0] != '\n' {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func batchKey(input, size string) string {
+	return input + "\x00" + size
+}
@@ -0,0 +1,139 @@
+package cropper
+
+import (
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "batch")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+
+	assert.NoError(os.MkdirAll(filepath.Join(in, "sub"), 0755))
+	for _, name := range []string{"a.png", "sub/b.png"} {
+		f, err := os.Create(filepath.Join(in, name))
+		assert.NoError(err)
+		assert.NoError(png.Encode(f, gradient(300, 200)))
+		f.Close()
+	}
+	assert.NoError(ioutil.WriteFile(filepath.Join(in, "broken.jpg"), []byte("not an image"), 0644))
+	assert.NoError(ioutil.WriteFile(filepath.Join(in, "notes.txt"), []byte("skip me"), 0644))
+
+	items, err := WalkImages(in, out)
+	assert.NoError(err)
+	assert.Len(items, 3)
+
+	opts := BatchOptions{
+		Sizes:     []SizeSpec{{Width: 100, Height: 100}, {AspectX: 16, AspectY: 9}},
+		InputDir:  in,
+		OutputDir: out,
+		Workers:   2,
+		Results:   filepath.Join(dir, "results.jsonl"),
+	}
+	summary, err := Batch(NewAnalyzer(Config{}), items, opts)
+	assert.NoError(err)
+	assert.Equal(BatchSummary{Processed: 4, Failed: 2}, summary)
+
+	for _, name := range []string{"100x100/a.png", "100x100/sub/b.png", "16-9/a.png", "16-9/sub/b.png"} {
+		_, err := os.Stat(filepath.Join(out, name))
+		assert.NoError(err, name)
+	}
+
+	// a second run only retries the failures
+	var failed []string
+	opts.Progress = func(res BatchResult) {
+		failed = append(failed, res.Input)
+	}
+	summary, err = Batch(NewAnalyzer(Config{}), items, opts)
+	assert.NoError(err)
+	assert.Equal(BatchSummary{Skipped: 4, Failed: 2}, summary)
+	assert.Equal([]string{"broken.jpg", "broken.jpg"}, failed)
+
+	results, err := ioutil.ReadFile(opts.Results)
+	assert.NoError(err)
+	assert.Equal(8, strings.Count(string(results), "\n"))
+}
+
+func TestWalkImagesSkipsOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "batch")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "thumbs", "100x100"), 0755))
+	for _, name := range []string{"a.png", "thumbs/100x100/a.png"} {
+		assert.NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte("png"), 0644))
+	}
+
+	items, err := WalkImages(dir, filepath.Join(dir, "thumbs"))
+	assert.NoError(err)
+	assert.Equal([]BatchItem{{Input: "a.png"}}, items)
+	items, err = WalkImages(dir, "")
+	assert.NoError(err)
+	assert.Len(items, 2)
+}
+
+func TestBatchOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	size := SizeSpec{Width: 100, Height: 100}
+	in := filepath.Join(os.TempDir(), "in")
+	tests := []struct {
+		input, format, output string
+	}{
+		{"a.jpg", "jpeg", "a.jpg"},
+		{"a.jpeg", "jpeg", "a.jpeg"},
+		{"a.bmp", "jpeg", "a.bmp.jpg"},
+		{"sub/a.png", "png", "sub/a.png"},
+		{"a.png", "jpeg", "a.png.jpg"},
+		{"a.webp", "gif", "a.webp.gif"},
+		{filepath.Join(in, "sub", "a.jpg"), "jpeg", "sub/a.jpg"},
+		{"../elsewhere/a.jpg", "jpeg", "a.jpg"},
+	}
+	for _, test := range tests {
+		assert.Equal(filepath.Join("out", "100x100", filepath.FromSlash(test.output)), batchOutput(test.input, size, test.format, in, "out"), test.input)
+	}
+
+	assert.NoError(batchCollisions([]BatchItem{{Input: "a.jpg"}, {Input: "a.jpeg"}, {Input: "a.bmp"}, {Input: "sub/a.jpg"}}, in))
+	for _, items := range [][]BatchItem{
+		{{Input: "a.jpg"}, {Input: "../elsewhere/a.jpg"}},
+		{{Input: "sub/a.jpg"}, {Input: filepath.Join(in, "sub", "a.jpg")}},
+		{{Input: "a.bmp"}, {Input: "a.bmp.jpg"}},
+	} {
+		_, err := Batch(NewAnalyzer(Config{}), items, BatchOptions{InputDir: in, OutputDir: "out"})
+		assert.Error(err, "%v", items)
+	}
+}
+
+func TestReadBatchManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	items, err := ReadBatchManifest(strings.NewReader(`{"input":"a.jpg"}
+
+{"input":"b.jpg","faces":[{"x":1,"y":2,"width":3,"height":4}]}
+`))
+	assert.NoError(err)
+	assert.Equal([]BatchItem{{Input: "a.jpg"}, {Input: "b.jpg", Faces: []Rect{{X: 1, Y: 2, Width: 3, Height: 4}}}}, items)
+
+	// workers would write the same outputs concurrently for a repeated input
+	items, err = ReadBatchManifest(strings.NewReader(`{"input":"a.jpg"}
+{"input":"b.jpg"}
+{"input":"a.jpg"}
+`))
+	assert.NoError(err)
+	_, err = Batch(NewAnalyzer(Config{}), items, BatchOptions{OutputDir: "out"})
+	assert.EqualError(err, `batch input "a.jpg" is listed twice`)
+
+	_, err = ReadBatchManifest(strings.NewReader("{broken"))
+	assert.Error(err)
+}
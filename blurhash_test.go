@@ -0,0 +1,54 @@
+package cropper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeBlurHash(t *testing.T) {
+	assert := assert.New(t)
+
+	// reference values computed with the algorithm of the woltapp/blurhash encoder
+	ramp := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			ramp.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 10), 128, 255})
+		}
+	}
+	hash, err := EncodeBlurHash(ramp, 4, 3)
+	assert.NoError(err)
+	assert.Equal("LxH27k2swxX8mHWWjtf7gJfjfQfj", hash)
+
+	solidImg := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(solidImg.Pix); i += 4 {
+		copy(solidImg.Pix[i:], []uint8{200, 100, 50, 255})
+	}
+	hash, err = EncodeBlurHash(solidImg, 4, 3)
+	assert.NoError(err)
+	assert.Equal("LNM|T9}XfQ}X}XsofQsofQfQfQfQ", hash)
+
+	_, err = EncodeBlurHash(ramp, 0, 3)
+	assert.Equal(ErrInvalidComponents, err)
+	_, err = EncodeBlurHash(ramp, 4, 10)
+	assert.Equal(ErrInvalidComponents, err)
+}
+
+func TestAnalyzePlaceholders(t *testing.T) {
+	assert := assert.New(t)
+
+	res, err := NewAnalyzer(Config{}).Analyze(gradient(300, 200), 100, 100, Options{BlurHash: true, LQIP: true})
+	assert.NoError(err)
+	assert.Len(res.BlurHash, 28)
+
+	data, err := base64.StdEncoding.DecodeString(res.LQIP)
+	assert.NoError(err)
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(err)
+	assert.True(img.Bounds().Dx() <= lqipSize && img.Bounds().Dy() <= lqipSize, "lqip is %v", img.Bounds())
+}
@@ -0,0 +1,91 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// detectBorders finds uniform margins around img and returns the remaining content area.
+// Each side is trimmed while its outermost line is nearly all within tolerance of the
+// color of the line that started the margin. If trimming would leave less than
+// borderMinContent of the image in either direction the full bounds are returned.
+func detectBorders(img *image.RGBA, tolerance float64) image.Rectangle {
+	b := img.Bounds()
+	if b.Empty() {
+		return b
+	}
+	top, bottom, left, right := b.Min.Y, b.Max.Y, b.Min.X, b.Max.X
+
+	if ref, ok := uniformLine(img, image.Rect(left, top, right, top+1), tolerance); ok {
+		for top < bottom && isUniform(img, image.Rect(left, top, right, top+1), ref, tolerance) {
+			top++
+		}
+	}
+	if ref, ok := uniformLine(img, image.Rect(left, bottom-1, right, bottom), tolerance); ok {
+		for bottom > top && isUniform(img, image.Rect(left, bottom-1, right, bottom), ref, tolerance) {
+			bottom--
+		}
+	}
+	if ref, ok := uniformLine(img, image.Rect(left, top, left+1, bottom), tolerance); ok {
+		for left < right && isUniform(img, image.Rect(left, top, left+1, bottom), ref, tolerance) {
+			left++
+		}
+	}
+	if ref, ok := uniformLine(img, image.Rect(right-1, top, right, bottom), tolerance); ok {
+		for right > left && isUniform(img, image.Rect(right-1, top, right, bottom), ref, tolerance) {
+			right--
+		}
+	}
+
+	content := image.Rect(left, top, right, bottom)
+	if float64(content.Dx()) < float64(b.Dx())*borderMinContent || float64(content.Dy()) < float64(b.Dy())*borderMinContent {
+		return b
+	}
+	return content
+}
+
+// uniformLine reports whether the pixels of line are close enough to their average color
+// to start a margin, and returns that color
+func uniformLine(img *image.RGBA, line image.Rectangle, tolerance float64) (color.RGBA, bool) {
+	ref := averageColor(img, line)
+	return ref, isUniform(img, line, ref, tolerance)
+}
+
+func isUniform(img *image.RGBA, line image.Rectangle, ref color.RGBA, tolerance float64) bool {
+	total, matching := 0, 0
+	for y := line.Min.Y; y < line.Max.Y; y++ {
+		for x := line.Min.X; x < line.Max.X; x++ {
+			total++
+			if colorDistance(img.RGBAAt(x, y), ref) <= tolerance {
+				matching++
+			}
+		}
+	}
+	return total > 0 && float64(matching) >= float64(total)*borderCoverage
+}
+
+func averageColor(img *image.RGBA, r image.Rectangle) color.RGBA {
+	var sr, sg, sb, n float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			sr += float64(c.R)
+			sg += float64(c.G)
+			sb += float64(c.B)
+			n++
+		}
+	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return color.RGBA{uint8(sr / n), uint8(sg / n), uint8(sb / n), 255}
+}
+
+// colorDistance returns the largest per channel difference between c1 and c2
+func colorDistance(c1, c2 color.RGBA) float64 {
+	dr := math.Abs(float64(c1.R) - float64(c2.R))
+	dg := math.Abs(float64(c1.G) - float64(c2.G))
+	db := math.Abs(float64(c1.B) - float64(c2.B))
+	return math.Max(dr, math.Max(dg, db))
+}
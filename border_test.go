@@ -0,0 +1,48 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// letterboxed returns a noisy image surrounded by black bars
+func letterboxed(width, height int, content image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0, 0, 0, 255}), image.Point{}, draw.Src)
+	rnd := rand.New(rand.NewSource(1))
+	for y := content.Min.Y; y < content.Max.Y; y++ {
+		for x := content.Min.X; x < content.Max.X; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), 255})
+		}
+	}
+	return img
+}
+
+func TestDetectBorders(t *testing.T) {
+	assert := assert.New(t)
+
+	content := image.Rect(0, 40, 320, 200)
+	img := letterboxed(320, 240, content)
+	assert.Equal(content, detectBorders(img, borderTolerance))
+
+	plain := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	assert.Equal(plain.Bounds(), detectBorders(plain, borderTolerance))
+}
+
+func TestAnalyzeTrimBorders(t *testing.T) {
+	assert := assert.New(t)
+
+	content := image.Rect(60, 0, 260, 240)
+	img := letterboxed(320, 240, content)
+
+	analyzer := NewAnalyzer(Config{TrimBorders: true})
+	res, err := analyzer.Analyze(img, 100, 100, Options{})
+	assert.NoError(err)
+	assert.Equal(content, res.Content)
+	assert.True(res.Crop.In(content), "crop %v outside content %v", res.Crop, content)
+}
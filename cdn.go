@@ -0,0 +1,86 @@
+package cropper
+
+import (
+	"fmt"
+	"image"
+)
+
+// FocalPoint returns the center of the crop
+func (r Result) FocalPoint() image.Point {
+	return image.Pt((r.Crop.Min.X+r.Crop.Max.X)/2, (r.Crop.Min.Y+r.Crop.Max.Y)/2)
+}
+
+// focalRatio returns the focal point relative to the source bounds, 0 to 1 on both axes
+func (r Result) focalRatio() (float64, float64) {
+	fp := r.FocalPoint().Sub(r.Bounds.Min)
+	if r.Bounds.Dx() == 0 || r.Bounds.Dy() == 0 {
+		return 0.5, 0.5
+	}
+	return float64(fp.X) / float64(r.Bounds.Dx()), float64(fp.Y) / float64(r.Bounds.Dy())
+}
+
+// relativeCrop returns the crop relative to the origin of the source image
+func (r Result) relativeCrop() image.Rectangle {
+	return r.Crop.Sub(r.Bounds.Min)
+}
+
+// Geometry returns the crop as an ImageMagick geometry string "WxH+X+Y"
+func Geometry(r image.Rectangle) string {
+	return fmt.Sprintf("%dx%d+%d+%d", r.Dx(), r.Dy(), r.Min.X, r.Min.Y)
+}
+
+// Imgix returns imgix query parameters cropping to the result and resizing to width x height
+func Imgix(r Result, width, height int) string {
+	c := r.relativeCrop()
+	return fmt.Sprintf("rect=%d,%d,%d,%d&w=%d&h=%d&fit=crop", c.Min.X, c.Min.Y, c.Dx(), c.Dy(), width, height)
+}
+
+// ImgixFocalPoint returns imgix query parameters filling width x height around the focal
+// point of the result
+func ImgixFocalPoint(r Result, width, height int) string {
+	fx, fy := r.focalRatio()
+	return fmt.Sprintf("w=%d&h=%d&fit=crop&crop=focalpoint&fp-x=%.4f&fp-y=%.4f", width, height, fx, fy)
+}
+
+// Cloudinary returns a Cloudinary transformation cropping to the result and scaling to
+// width x height
+func Cloudinary(r Result, width, height int) string {
+	c := r.relativeCrop()
+	return fmt.Sprintf("c_crop,w_%d,h_%d,x_%d,y_%d/c_scale,w_%d,h_%d", c.Dx(), c.Dy(), c.Min.X, c.Min.Y, width, height)
+}
+
+// CloudinaryFocalPoint returns a Cloudinary transformation cropping around the focal point
+// of the result with its custom coordinates gravity and scaling to width x height
+func CloudinaryFocalPoint(r Result, width, height int) string {
+	c := r.relativeCrop()
+	fp := r.FocalPoint().Sub(r.Bounds.Min)
+	return fmt.Sprintf("c_crop,g_xy_center,w_%d,h_%d,x_%d,y_%d/c_scale,w_%d,h_%d", c.Dx(), c.Dy(), fp.X, fp.Y, width, height)
+}
+
+// Thumbor returns the Thumbor URL path segments cropping to the result and resizing to
+// width x height
+func Thumbor(r Result, width, height int) string {
+	c := r.relativeCrop()
+	return fmt.Sprintf("%dx%d:%dx%d/%dx%d/", c.Min.X, c.Min.Y, c.Max.X, c.Max.Y, width, height)
+}
+
+// ThumborFocalPoint returns the Thumbor URL path segments resizing to width x height and
+// marking the result as focal region for Thumbor's own cropping
+func ThumborFocalPoint(r Result, width, height int) string {
+	c := r.relativeCrop()
+	return fmt.Sprintf("%dx%d/filters:focal(%dx%d:%dx%d)/", width, height, c.Min.X, c.Min.Y, c.Max.X, c.Max.Y)
+}
+
+// Imgproxy returns imgproxy processing options cropping to the result and filling
+// width x height
+func Imgproxy(r Result, width, height int) string {
+	c := r.relativeCrop()
+	return fmt.Sprintf("crop:%d:%d:nowe:%d:%d/resize:fill:%d:%d", c.Dx(), c.Dy(), c.Min.X, c.Min.Y, width, height)
+}
+
+// ImgproxyFocalPoint returns imgproxy processing options filling width x height around the
+// focal point of the result
+func ImgproxyFocalPoint(r Result, width, height int) string {
+	fx, fy := r.focalRatio()
+	return fmt.Sprintf("resize:fill:%d:%d/gravity:fp:%.4f:%.4f", width, height, fx, fy)
+}
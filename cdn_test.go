@@ -0,0 +1,25 @@
+package cropper
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCDNFormatters(t *testing.T) {
+	assert := assert.New(t)
+
+	res := Result{Crop: image.Rect(100, 50, 400, 350), Bounds: image.Rect(0, 0, 800, 400)}
+
+	assert.Equal(image.Pt(250, 200), res.FocalPoint())
+	assert.Equal("300x300+100+50", Geometry(res.Crop))
+	assert.Equal("rect=100,50,300,300&w=150&h=150&fit=crop", Imgix(res, 150, 150))
+	assert.Equal("w=150&h=150&fit=crop&crop=focalpoint&fp-x=0.3125&fp-y=0.5000", ImgixFocalPoint(res, 150, 150))
+	assert.Equal("c_crop,w_300,h_300,x_100,y_50/c_scale,w_150,h_150", Cloudinary(res, 150, 150))
+	assert.Equal("c_crop,g_xy_center,w_300,h_300,x_250,y_200/c_scale,w_150,h_150", CloudinaryFocalPoint(res, 150, 150))
+	assert.Equal("100x50:400x350/150x150/", Thumbor(res, 150, 150))
+	assert.Equal("150x150/filters:focal(100x50:400x350)/", ThumborFocalPoint(res, 150, 150))
+	assert.Equal("crop:300:300:nowe:100:50/resize:fill:150:150", Imgproxy(res, 150, 150))
+	assert.Equal("resize:fill:150:150/gravity:fp:0.3125:0.5000", ImgproxyFocalPoint(res, 150, 150))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/intwinelabs/cropper"
+)
+
+// runBatch implements the batch subcommand
+func runBatch(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("cropper batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	sizes := fs.String("size", "", "comma separated output sizes, e.g. 300x200,16:9")
+	dir := fs.String("dir", "", "directory to crop all images below")
+	manifest := fs.String("manifest", "", `JSONL file with one {"input":"path","faces":[...]} per line, paths are relative to -dir`)
+	out := fs.String("out", "", "output directory, receives one sub directory per size")
+	results := fs.String("results", "", "JSONL results manifest used to resume runs (default OUT/results.jsonl)")
+	workers := fs.Int("workers", runtime.NumCPU(), "number of images processed concurrently")
+	preset := fs.String("preset", "default", "tuning preset: "+strings.Join(presetNames(), ", "))
+	format := fs.String("format", "", "output format: jpeg, png or gif (default from the input)")
+	quality := fs.Int("quality", 0, "JPEG quality from 1 to 100")
+	debug := fs.Bool("debug", false, "log analyzer details")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: cropper batch -size SPECS (-dir DIR | -manifest FILE) -out DIR [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" || *dir == "" && *manifest == "" {
+		fs.Usage()
+		return errors.New("batch needs -out and either -dir or -manifest")
+	}
+	if _, ok := presets[*preset]; !ok || *preset == "product" {
+		return fmt.Errorf("unsupported batch preset %q", *preset)
+	}
+
+	opts := cropper.BatchOptions{
+		InputDir:  *dir,
+		OutputDir: *out,
+		Workers:   *workers,
+		Encoder:   cropper.EncoderOptions{Format: *format, Quality: *quality},
+		Results:   *results,
+		Progress: func(res cropper.BatchResult) {
+			if res.Error != "" {
+				fmt.Fprintf(stderr, "%s (%s): %s\n", res.Input, res.Size, res.Error)
+			}
+		},
+	}
+	if opts.Results == "" {
+		opts.Results = filepath.Join(*out, "results.jsonl")
+	}
+	for _, spec := range strings.Split(*sizes, ",") {
+		size, err := cropper.ParseSizeSpec(spec)
+		if err != nil {
+			return err
+		}
+		opts.Sizes = append(opts.Sizes, size)
+	}
+
+	items, err := batchItems(*dir, *manifest, *out)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+
+	summary, err := cropper.Batch(cropper.NewAnalyzer(newConfig(options{preset: *preset, debug: *debug})), items, opts)
+	fmt.Fprintf(stdout, "processed %d, skipped %d, failed %d\n", summary.Processed, summary.Skipped, summary.Failed)
+	if err != nil {
+		return err
+	}
+	if summary.Failed > 0 {
+		return fmt.Errorf("%d crops failed", summary.Failed)
+	}
+	return nil
+}
+
+// batchItems reads the manifest when given and walks dir, leaving out the output directory,
+// otherwise
+func batchItems(dir, manifest, out string) ([]cropper.BatchItem, error) {
+	if manifest == "" {
+		return cropper.WalkImages(dir, out)
+	}
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return cropper.ReadBatchManifest(f)
+}
@@ -0,0 +1,243 @@
+// Command cropper crops an image to the requested size using the smart crop analyzer.
+//
+//	cropper -size 300x200 -o thumb.jpg photo.jpg
+//	cat photo.jpg | cropper -size 16:9 -json
+//	cropper batch -size 300x200,16:9 -dir photos -out thumbs
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/intwinelabs/cropper"
+	"github.com/intwinelabs/logger"
+)
+
+// productPadding is the default padding around the subject for the product preset
+const productPadding = 0.05
+
+// presets are the tuning presets selectable with -preset, "product" additionally switches
+// to FindProductCrop
+var presets = map[string]cropper.Config{
+	"default":   {},
+	"portrait":  {DetectFocus: true, Composition: cropper.CenterWeighted},
+	"landscape": {DetectSaliency: true, Composition: cropper.GoldenRatio},
+	"scan":      {TrimBorders: true},
+	"zoom":      {DetectSaliency: true, MinZoom: 0.25},
+	"entropy":   {Strategy: cropper.StrategyEntropy},
+	"product":   {},
+}
+
+type options struct {
+	size     cropper.SizeSpec
+	preset   string
+	padding  float64
+	faces    []image.Rectangle
+	format   string
+	quality  int
+	metadata bool
+	stripGPS bool
+	json     bool
+	debug    bool
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "cropper:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) > 0 && args[0] == "batch" {
+		return runBatch(args[1:], stdout, stderr)
+	}
+
+	fs := flag.NewFlagSet("cropper", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	size := fs.String("size", "", `output size: "300x200", "16:9", "300x", "x200", "50%" or "300x300>"`)
+	preset := fs.String("preset", "default", "tuning preset: "+strings.Join(presetNames(), ", "))
+	padding := fs.Float64("padding", productPadding, "padding around the subject for the product preset")
+	faces := fs.String("faces", "", `JSON file with face rectangles [{"x":0,"y":0,"width":0,"height":0}]`)
+	output := fs.String("o", "-", `output file, "-" for stdout`)
+	format := fs.String("format", "", "output format: jpeg, png or gif (default from -o or the input)")
+	quality := fs.Int("quality", 0, "JPEG quality from 1 to 100")
+	metadata := fs.Bool("metadata", false, "keep EXIF and ICC metadata in JPEG output")
+	stripGPS := fs.Bool("strip-gps", false, "remove the GPS location from kept EXIF metadata")
+	asJSON := fs.Bool("json", false, "print the crop as JSON instead of writing the image")
+	debug := fs.Bool("debug", false, "log analyzer details")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: cropper -size SPEC [flags] [input]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("expected at most one input")
+	}
+
+	opts := options{
+		preset:   *preset,
+		padding:  *padding,
+		format:   *format,
+		quality:  *quality,
+		metadata: *metadata,
+		stripGPS: *stripGPS,
+		json:     *asJSON,
+		debug:    *debug,
+	}
+	var err error
+	if opts.size, err = cropper.ParseSizeSpec(*size); err != nil {
+		return err
+	}
+	if _, ok := presets[opts.preset]; !ok {
+		return fmt.Errorf("unknown preset %q", opts.preset)
+	}
+	if *faces != "" {
+		if opts.faces, err = readFaces(*faces); err != nil {
+			return err
+		}
+	}
+	if opts.format == "" && *output != "-" {
+		opts.format = formatFromPath(*output)
+	}
+
+	data, err := readInput(fs.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	conf := newConfig(opts)
+	if err := process(cropper.NewAnalyzer(conf), cropper.NewCodec(conf), data, opts, &out); err != nil {
+		return err
+	}
+	if *output == "-" {
+		_, err = out.WriteTo(stdout)
+		return err
+	}
+	return ioutil.WriteFile(*output, out.Bytes(), 0644)
+}
+
+// newConfig returns the analyzer configuration of the preset, with a logger when debugging
+func newConfig(opts options) cropper.Config {
+	conf := presets[opts.preset]
+	conf.Debug = opts.debug
+	if conf.Debug {
+		conf.Logger = logger.New()
+	}
+	return conf
+}
+
+// process crops the image in data and writes the encoded crop, or its JSON report, to w
+func process(analyzer cropper.Analyzer, codec cropper.Codec, data []byte, opts options, w io.Writer) error {
+	img, inputFormat, err := codec.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res, err := analyze(analyzer, img, opts)
+	if err != nil {
+		return err
+	}
+	res.Format = inputFormat
+
+	if opts.json {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res.Report())
+	}
+
+	format := opts.format
+	if format == "" {
+		format = outputFormat(inputFormat)
+	}
+	encOpts := cropper.EncoderOptions{Format: format, Quality: opts.quality, StripGPS: opts.stripGPS}
+	if opts.metadata {
+		encOpts.Metadata = cropper.ReadMetadata(data)
+	}
+	enc, err := cropper.NewEncoder(encOpts)
+	if err != nil {
+		return err
+	}
+	return codec.WriteResult(w, img, res, enc)
+}
+
+func analyze(analyzer cropper.Analyzer, img image.Image, opts options) (cropper.Result, error) {
+	if opts.preset != "product" {
+		return analyzer.AnalyzeSize(img, opts.size, cropper.Options{Faces: opts.faces})
+	}
+	width, height, err := opts.size.Resolve(img.Bounds())
+	if err != nil {
+		return cropper.Result{}, err
+	}
+	return analyzer.FindProductCrop(img, width, height, opts.padding)
+}
+
+// readInput reads the named file, or stdin when name is empty or "-"
+func readInput(name string, stdin io.Reader) ([]byte, error) {
+	if name == "" || name == "-" {
+		return ioutil.ReadAll(stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// readFaces reads face rectangles, in displayed image coordinates, from a JSON file
+func readFaces(name string) ([]image.Rectangle, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var rects []cropper.Rect
+	if err := json.Unmarshal(data, &rects); err != nil {
+		return nil, fmt.Errorf("faces %s: %v", name, err)
+	}
+	faces := make([]image.Rectangle, len(rects))
+	for i, r := range rects {
+		faces[i] = r.Rectangle()
+	}
+	return faces, nil
+}
+
+// formatFromPath returns the output format for a file name, empty if the extension is unknown
+func formatFromPath(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	case ".gif":
+		return "gif"
+	}
+	return ""
+}
+
+// outputFormat returns the format to write for an input format, JPEG for inputs that
+// cannot be encoded
+func outputFormat(inputFormat string) string {
+	switch inputFormat {
+	case "jpeg", "png", "gif":
+		return inputFormat
+	}
+	return "jpeg"
+}
+
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
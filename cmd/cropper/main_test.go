@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intwinelabs/cropper"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRunJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	err := run([]string{"-size", "100x100", "-json"}, bytes.NewReader(testPNG(t, 300, 200)), &out, ioutil.Discard)
+	assert.NoError(err)
+
+	var report cropper.Report
+	assert.NoError(json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(100, report.Width)
+	assert.Equal(report.Crop.Width, report.Crop.Height)
+	assert.Equal("png", report.Format)
+}
+
+func TestRunImage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "cropper")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "in.png")
+	assert.NoError(ioutil.WriteFile(input, testPNG(t, 300, 200), 0644))
+
+	var out bytes.Buffer
+	assert.NoError(run([]string{"-size", "x50", "-format", "png", input}, nil, &out, ioutil.Discard))
+	img, format, err := image.Decode(&out)
+	assert.NoError(err)
+	assert.Equal("png", format)
+	assert.Equal(image.Rect(0, 0, 75, 50), img.Bounds())
+
+	output := filepath.Join(dir, "out.jpg")
+	assert.NoError(run([]string{"-size", "16:9", "-preset", "portrait", "-o", output, input}, nil, &out, ioutil.Discard))
+	data, err := ioutil.ReadFile(output)
+	assert.NoError(err)
+	_, format, err = image.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(err)
+	assert.Equal("jpeg", format)
+
+	assert.Error(run([]string{"-size", "bogus", input}, nil, &out, ioutil.Discard))
+	assert.Error(run([]string{"-size", "10x10", "-preset", "bogus", input}, nil, &out, ioutil.Discard))
+}
+
+func TestRunBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "cropper")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	assert.NoError(os.Mkdir(in, 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(in, "a.png"), testPNG(t, 300, 200), 0644))
+
+	var stdout bytes.Buffer
+	assert.NoError(run([]string{"batch", "-size", "50x50,x20", "-dir", in, "-out", out}, nil, &stdout, ioutil.Discard))
+	assert.Equal("processed 2, skipped 0, failed 0\n", stdout.String())
+	for _, name := range []string{"50x50/a.png", "x20/a.png", "results.jsonl"} {
+		_, err := os.Stat(filepath.Join(out, name))
+		assert.NoError(err, name)
+	}
+
+	stdout.Reset()
+	assert.NoError(run([]string{"batch", "-size", "50x50,x20", "-dir", in, "-out", out}, nil, &stdout, ioutil.Discard))
+	assert.Equal("processed 0, skipped 2, failed 0\n", stdout.String())
+}
@@ -0,0 +1,75 @@
+// Command cropperd serves smart crops over HTTP.
+//
+//	GET  /health
+//	POST /crop?size=300x200                    image as request body or multipart "image" field
+//	GET  /crop?size=16:9&path=a/b.jpg          image read below -root
+//	POST /crop?size=300x200&output=image       respond with the cropped image instead of JSON
+//	GET  /smart/300x200/a/b.jpg                cropped image read below -root, cacheable
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/intwinelabs/cropper"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	root := flag.String("root", "", "directory /crop paths and /smart/ images are read from, empty disables them")
+	maxBytes := flag.Int64("max-bytes", 32<<20, "maximum size of an image in bytes")
+	maxPixels := flag.Int64("max-pixels", 50000000, "maximum number of pixels of an image")
+	maxOutputPixels := flag.Int64("max-output-pixels", 16000000, "maximum number of pixels of a cropped image response")
+	timeout := flag.Duration("timeout", 30*time.Second, "maximum time spent on a request")
+	maxAge := flag.Duration("max-age", 24*time.Hour, "Cache-Control max-age of /smart/ responses")
+	etagSalt := flag.String("etag-salt", "", "mixed into /smart/ ETags, change it to invalidate cached crops after retuning")
+	workers := flag.Int("workers", runtime.NumCPU(), "maximum number of images processed at once")
+	debug := flag.Bool("debug", false, "log every request")
+	flag.Parse()
+
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	// analyzer debugging stays off, it writes debug images shared by concurrent requests
+	conf := cropper.Config{MaxBytes: *maxBytes, MaxPixels: *maxPixels}
+	s := &server{
+		analyzer:        cropper.NewAnalyzer(conf),
+		codec:           cropper.NewCodec(conf),
+		root:            *root,
+		maxBytes:        *maxBytes,
+		maxOutputPixels: *maxOutputPixels,
+		timeout:         *timeout,
+		maxAge:          *maxAge,
+		etagSalt:        *etagSalt,
+		slots:           make(chan struct{}, *workers),
+		debug:           *debug,
+	}
+	srv := &http.Server{
+		Addr:         *addr,
+		Handler:      s.routes(),
+		ReadTimeout:  *timeout,
+		WriteTimeout: *timeout + 5*time.Second,
+	}
+
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	log.Printf("cropperd listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
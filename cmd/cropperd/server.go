@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/intwinelabs/cropper"
+)
+
+// errNoRoot gets returned for path requests when the server has no root directory
+var errNoRoot = errors.New("Local paths are disabled")
+
+// server serves crops of uploaded or local images
+type server struct {
+	analyzer cropper.Analyzer
+	codec    cropper.Codec
+	// root is the directory local image paths are resolved against, empty disables them
+	root string
+	// maxBytes limits the size of request bodies and local images
+	maxBytes int64
+	// maxOutputPixels limits the size of encoded crops, the requested size is checked
+	// before the output gets allocated
+	maxOutputPixels int64
+	// timeout bounds the time spent on a single request
+	timeout time.Duration
+	// maxAge is the Cache-Control max-age of /smart/ responses
+	maxAge time.Duration
+	// etagSalt is mixed into /smart/ ETags, changing it after a tuning or configuration
+	// change makes caches fetch the new crops
+	etagSalt string
+	// slots bounds the number of crops running at once, including crops of requests that
+	// already timed out
+	slots chan struct{}
+	// debug logs every request with its status and duration
+	debug bool
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/crop", s.handleCrop)
+	mux.HandleFunc("/smart/", s.handleSmart)
+	if s.debug {
+		return logRequests(mux)
+	}
+	return mux
+}
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs method, path, status and duration of every request handled by h
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		log.Printf("%s %s: %d in %v", r.Method, r.URL.Path, rec.status, time.Since(start))
+	})
+}
+
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleCrop crops an image uploaded as request body, as "image" field of a multipart form
+// or referenced by the "path" parameter. It responds with the crop as JSON, or with the
+// cropped and resized image when "output" is "image".
+func (s *server) handleCrop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxBytes)
+
+	params, err := s.params(r)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	size, err := cropper.ParseSizeSpec(params.Get("size"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data, err := s.readImage(r, params.Get("path"))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	var opts encodeOptions
+	if params.Get("output") == "image" {
+		quality, _ := strconv.Atoi(params.Get("quality"))
+		opts = encodeOptions{image: true, format: params.Get("format"), quality: quality}
+	}
+	var body []byte
+	var contentType string
+	err = s.wait(ctx, func(ctx context.Context) (err error) {
+		body, contentType, err = s.crop(ctx, data, size, opts)
+		return err
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
+
+// encodeOptions select the response of a crop
+type encodeOptions struct {
+	// image requests the cropped image instead of the JSON report
+	image   bool
+	format  string
+	quality int
+}
+
+// crop crops the image in data to size and returns the response body and its content type.
+// It gives up between decoding, analysis and encoding once ctx is done.
+func (s *server) crop(ctx context.Context, data []byte, size cropper.SizeSpec, opts encodeOptions) ([]byte, string, error) {
+	img, format, err := s.codec.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	if opts.image {
+		if err := s.checkOutput(img.Bounds(), size); err != nil {
+			return nil, "", err
+		}
+	}
+	res, err := s.analyzer.AnalyzeSize(img, size, cropper.Options{})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+	res.Format = format
+	if !opts.image {
+		body, err := json.Marshal(res.Report())
+		return body, "application/json", err
+	}
+
+	enc, err := cropper.NewEncoder(cropper.EncoderOptions{Format: outputFormat(opts.format, format), Quality: opts.quality})
+	if err != nil {
+		return nil, "", err
+	}
+	var buf bytes.Buffer
+	if err := s.codec.WriteResult(&buf, img, res, enc); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), enc.ContentType(), nil
+}
+
+// checkOutput returns a LimitError when size resolves to an output larger than the server
+// allows for an image with the given bounds. Percentages above 100 would only enlarge the
+// image and are rejected.
+func (s *server) checkOutput(bounds image.Rectangle, size cropper.SizeSpec) error {
+	if size.Percent > 100 {
+		return &cropper.SizeSpecError{Spec: size.String()}
+	}
+	width, height, err := size.Resolve(bounds)
+	if err != nil {
+		return err
+	}
+	if pixels := int64(width) * int64(height); s.maxOutputPixels > 0 && pixels > s.maxOutputPixels {
+		return &cropper.LimitError{Limit: "output pixels", Value: pixels, Max: s.maxOutputPixels}
+	}
+	return nil
+}
+
+// params returns the request parameters, only multipart bodies are parsed so raw uploads
+// are never mistaken for form data
+func (s *server) params(r *http.Request) (url.Values, error) {
+	if !isMultipart(r) {
+		return r.URL.Query(), nil
+	}
+	if err := r.ParseMultipartForm(s.maxBytes); err != nil {
+		return nil, err
+	}
+	return r.Form, nil
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// wait runs fn once one of the server slots is free and waits for it to finish or for ctx
+// to be done. fn keeps its slot and keeps running in the background after a timeout, so it
+// must not write to the response and should return early once its ctx is done.
+func (s *server) wait(ctx context.Context, fn func(ctx context.Context) error) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() { <-s.slots }()
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readImage returns the image of a crop request, read from path when given
+func (s *server) readImage(r *http.Request, path string) ([]byte, error) {
+	if path != "" {
+		data, _, err := s.readLocal(path)
+		return data, err
+	}
+	if !isMultipart(r) {
+		return ioutil.ReadAll(r.Body)
+	}
+
+	f, _, err := r.FormFile("image")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// readLocal reads the image at path below the root directory and returns it along with
+// its modification time
+func (s *server) readLocal(path string) ([]byte, time.Time, error) {
+	if s.root == "" {
+		return nil, time.Time{}, errNoRoot
+	}
+	f, err := os.Open(filepath.Join(s.root, filepath.FromSlash(cleanPath(path))))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if info.IsDir() {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, s.maxBytes+1))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, time.Time{}, &cropper.LimitError{Limit: "bytes", Value: int64(len(data)), Max: s.maxBytes}
+	}
+	return data, info.ModTime(), nil
+}
+
+// cleanPath returns path as a clean slash separated path that cannot leave its root
+func cleanPath(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// outputFormat returns the requested output format, or the input format when it can be encoded
+func outputFormat(requested, input string) string {
+	if requested != "" {
+		return requested
+	}
+	switch input {
+	case "jpeg", "png", "gif":
+		return input
+	}
+	return "jpeg"
+}
+
+// errorStatus maps errors of the analyzer and the request to HTTP status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, cropper.ErrImageTooLarge), errors.As(err, new(*http.MaxBytesError)):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, cropper.ErrUnsupportedFormat), errors.Is(err, cropper.ErrUnknownEncoding):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, cropper.ErrCorruptImage):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, cropper.ErrInvalidSizeSpec), errors.Is(err, cropper.ErrInvalidDimensions),
+		errors.Is(err, cropper.ErrUnsupportedOption), errors.Is(err, http.ErrMissingFile):
+		return http.StatusBadRequest
+	case errors.Is(err, errNoRoot):
+		return http.StatusForbidden
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		// the client went away, nobody reads the response
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
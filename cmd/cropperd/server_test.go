@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/intwinelabs/cropper"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newServer(root string) *server {
+	return &server{
+		analyzer:        cropper.NewAnalyzer(cropper.Config{}),
+		codec:           cropper.NewCodec(cropper.Config{}),
+		root:            root,
+		maxBytes:        1 << 20,
+		maxOutputPixels: 1 << 20,
+		timeout:         10 * time.Second,
+		maxAge:          time.Hour,
+		slots:           make(chan struct{}, 2),
+	}
+}
+
+func newTestServer(root string) *httptest.Server {
+	return httptest.NewServer(newServer(root).routes())
+}
+
+func TestHealth(t *testing.T) {
+	ts := newTestServer("")
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/health")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCropUpload(t *testing.T) {
+	assert := assert.New(t)
+	ts := newTestServer("")
+	defer ts.Close()
+	data := testPNG(t, 300, 200)
+
+	resp, err := http.Post(ts.URL+"/crop?size=100x100", "image/png", bytes.NewReader(data))
+	assert.NoError(err)
+	var report cropper.Report
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&report))
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(report.Crop.Width, report.Crop.Height)
+	assert.Equal("png", report.Format)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("size", "x50")
+	mw.WriteField("output", "image")
+	part, _ := mw.CreateFormFile("image", "a.png")
+	part.Write(data)
+	mw.Close()
+	resp, err = http.Post(ts.URL+"/crop", mw.FormDataContentType(), &body)
+	assert.NoError(err)
+	img, format, err := image.Decode(resp.Body)
+	resp.Body.Close()
+	assert.NoError(err)
+	assert.Equal("png", format)
+	assert.Equal("image/png", resp.Header.Get("Content-Type"))
+	assert.Equal(image.Rect(0, 0, 75, 50), img.Bounds())
+}
+
+func TestCropErrors(t *testing.T) {
+	assert := assert.New(t)
+	ts := newTestServer("")
+	defer ts.Close()
+
+	cases := []struct {
+		url    string
+		body   []byte
+		status int
+	}{
+		{"/crop?size=bogus", testPNG(t, 10, 10), http.StatusBadRequest},
+		{"/crop?size=10x10", []byte("plain text"), http.StatusUnsupportedMediaType},
+		{"/crop?size=10x10", testPNG(t, 10, 10)[:50], http.StatusUnprocessableEntity},
+		{"/crop?size=10x10", make([]byte, 2<<20), http.StatusRequestEntityTooLarge},
+		{"/crop?size=10x10&path=a.png", nil, http.StatusForbidden},
+		{"/crop?size=100000x100000&output=image", testPNG(t, 10, 10), http.StatusRequestEntityTooLarge},
+		{"/crop?size=100000x&output=image", testPNG(t, 10, 10), http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		resp, err := http.Post(ts.URL+c.url, "application/octet-stream", bytes.NewReader(c.body))
+		assert.NoError(err)
+		resp.Body.Close()
+		assert.Equal(c.status, resp.StatusCode, c.url)
+	}
+}
+
+func TestCropPath(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "cropperd")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "a.png"), testPNG(t, 300, 200), 0644))
+
+	ts := newTestServer(dir)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/crop?size=16:9&path=a.png")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/crop?size=16:9&path=../../etc/passwd")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWaitTimeout(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer("")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	err := s.wait(ctx, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.Equal(http.StatusGatewayTimeout, errorStatus(err))
+
+	// the timed out work keeps its slot until it returns
+	assert.Len(s.slots, 1)
+	close(release)
+	assert.Eventually(func() bool { return len(s.slots) == 0 }, time.Second, time.Millisecond)
+}
+
+func TestWaitSlots(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer("")
+	for i := 0; i < cap(s.slots); i++ {
+		s.slots <- struct{}{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	err := s.wait(ctx, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	assert.Equal(context.DeadlineExceeded, err)
+	assert.False(ran, "work started without a free slot")
+
+	<-s.slots
+	assert.NoError(s.wait(context.Background(), func(ctx context.Context) error {
+		ran = true
+		return nil
+	}))
+	assert.True(ran)
+}
+
+func TestCropCanceled(t *testing.T) {
+	s := newServer("")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := s.crop(ctx, testPNG(t, 300, 200), cropper.SizeSpec{Width: 100, Height: 100}, encodeOptions{})
+	assert.Equal(t, context.Canceled, err)
+}
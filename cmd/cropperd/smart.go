@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/intwinelabs/cropper"
+)
+
+// handleSmart serves /smart/SIZE/PATH, the image at PATH below the root directory cropped
+// and resized to SIZE. The optional "format" and "quality" parameters select the encoding.
+// Responses carry an ETag derived from the source bytes and the transformation, so a CDN in
+// front of the server can cache and revalidate them.
+func (s *server) handleSmart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/smart/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		writeError(w, http.StatusNotFound, errors.New("Expected /smart/SIZE/PATH"))
+		return
+	}
+	size, err := cropper.ParseSizeSpec(parts[0])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	quality, _ := strconv.Atoi(r.URL.Query().Get("quality"))
+	opts := encodeOptions{image: true, format: r.URL.Query().Get("format"), quality: quality}
+
+	data, modTime, err := s.readLocal(parts[1])
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	etag := smartETag(data, size, opts, s.etagSalt)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(s.maxAge.Seconds())))
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body []byte
+	var contentType string
+	err = s.wait(ctx, func(ctx context.Context) (err error) {
+		body, contentType, err = s.crop(ctx, data, size, opts)
+		return err
+	})
+	if err != nil {
+		w.Header().Del("ETag")
+		w.Header().Set("Cache-Control", "no-store")
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(body))
+}
+
+// smartETag returns a strong ETag for the transformation of the source image in data, salt
+// identifies the server configuration so changing it invalidates cached crops
+func smartETag(data []byte, size cropper.SizeSpec, opts encodeOptions, salt string) string {
+	h := sha256.New()
+	h.Write(data)
+	fmt.Fprintf(h, "\x00%s\x00%s\x00%d\x00%s", size, opts.format, opts.quality, salt)
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
+}
+
+// etagMatch reports whether the If-None-Match header value matches etag
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/intwinelabs/cropper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmart(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "cropperd")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	assert.NoError(os.Mkdir(filepath.Join(dir, "photos"), 0755))
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "photos", "a.png"), testPNG(t, 300, 200), 0644))
+
+	ts := newTestServer(dir)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/smart/100x100/photos/a.png")
+	assert.NoError(err)
+	img, format, err := image.Decode(resp.Body)
+	resp.Body.Close()
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("png", format)
+	assert.Equal(image.Rect(0, 0, 100, 100), img.Bounds())
+	assert.Equal("image/png", resp.Header.Get("Content-Type"))
+	assert.Equal("public, max-age=3600", resp.Header.Get("Cache-Control"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(etag)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/smart/100x100/photos/a.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusNotModified, resp.StatusCode)
+
+	// another size or format is another representation
+	resp, err = http.Get(ts.URL + "/smart/50x50/photos/a.png?format=jpeg")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("image/jpeg", resp.Header.Get("Content-Type"))
+	assert.NotEqual(etag, resp.Header.Get("ETag"))
+
+	for url, status := range map[string]int{
+		"/smart/100x100/photos/missing.png": http.StatusNotFound,
+		"/smart/100x100/photos":             http.StatusNotFound,
+		"/smart/100x100/":                   http.StatusNotFound,
+		"/smart/bogus/photos/a.png":         http.StatusBadRequest,
+		"/smart/200%25/photos/a.png":        http.StatusBadRequest,
+		"/smart/1e6%25/photos/a.png":        http.StatusBadRequest,
+		"/smart/100000x100000/photos/a.png": http.StatusRequestEntityTooLarge,
+	} {
+		resp, err := http.Get(ts.URL + url)
+		assert.NoError(err)
+		resp.Body.Close()
+		assert.Equal(status, resp.StatusCode, url)
+		assert.Empty(resp.Header.Get("ETag"), url)
+	}
+
+	assert.NotEqual(smartETag([]byte("a"), cropper.SizeSpec{Width: 1}, encodeOptions{}, ""),
+		smartETag([]byte("a"), cropper.SizeSpec{Width: 1}, encodeOptions{}, "v2"))
+}
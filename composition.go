@@ -0,0 +1,57 @@
+package cropper
+
+import "math"
+
+// CompositionRule weights positions inside a candidate crop. px and py are the distances
+// from the crop center, 0 at the center and 1 at the crop edges, edge is the (negative)
+// penalty already applied close to the crop borders.
+type CompositionRule interface {
+	Weight(px, py, edge float64) float64
+}
+
+var (
+	// RuleOfThirds favors the center and features on the lines dividing the crop in thirds
+	RuleOfThirds CompositionRule = gridRule{line: 1.0 / 3.0}
+	// GoldenRatio favors the center and features on the phi grid lines (0.382/0.618)
+	GoldenRatio CompositionRule = gridRule{line: 1.0 - 2.0/(1.0+math.Sqrt(5.0))}
+	// CenterWeighted favors features the closer they are to the center of the crop
+	CenterWeighted CompositionRule = centerRule{}
+	// NoComposition weights every position inside the crop equally, only the edge
+	// penalty still applies
+	NoComposition CompositionRule = noneRule{}
+)
+
+// centerPrior is the base weight shared by the built-in rules
+func centerPrior(px, py float64) float64 {
+	return 1.41 - math.Sqrt(px*px+py*py)
+}
+
+type centerRule struct{}
+
+func (centerRule) Weight(px, py, edge float64) float64 {
+	return centerPrior(px, py)
+}
+
+type noneRule struct{}
+
+func (noneRule) Weight(px, py, edge float64) float64 {
+	return 1.0
+}
+
+// gridRule adds a bonus for features close to the grid lines at the given fraction of the
+// crop width and height
+type gridRule struct {
+	line float64
+}
+
+func (r gridRule) Weight(px, py, edge float64) float64 {
+	s := centerPrior(px, py)
+	return s + (math.Max(0.0, s+edge+0.5)*1.2)*(r.bonus(px)+r.bonus(py))
+}
+
+// bonus peaks at 1 on the grid line, px measures from the center while lines are given
+// from the edge so the line sits at 1-2*line
+func (r gridRule) bonus(x float64) float64 {
+	x = (x - (1.0 - 2.0*r.line)) * 8.0
+	return math.Max(1.0-x*x, 0.0)
+}
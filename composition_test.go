@@ -0,0 +1,79 @@
+package cropper
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// baselineThirds is the importance of the original hardcoded rule of thirds
+func baselineThirds(px, py, d float64) float64 {
+	thirds := func(x float64) float64 {
+		x = (math.Mod(x-(1.0/3.0)+1.0, 2.0)*0.5 - 0.5) * 16.0
+		return math.Max(1.0-x*x, 0.0)
+	}
+	s := 1.41 - math.Sqrt(px*px+py*py)
+	s += (math.Max(0.0, s+d+0.5) * 1.2) * (thirds(px) + thirds(py))
+	return s
+}
+
+func TestCompositionRules(t *testing.T) {
+	assert := assert.New(t)
+
+	for px := 0.0; px <= 1.0; px += 0.05 {
+		for py := 0.0; py <= 1.0; py += 0.05 {
+			for _, d := range []float64{0, -0.5, -3} {
+				assert.InDelta(baselineThirds(px, py, d), RuleOfThirds.Weight(px, py, d), 1e-9, "px %f py %f", px, py)
+			}
+			assert.Equal(1.0, NoComposition.Weight(px, py, -1))
+		}
+	}
+
+	// the grid rules peak on their lines, measured from the center
+	thirdsLine := 1.0 / 3.0
+	phiLine := 1.0 - 2.0*(1.0-2.0/(1.0+math.Sqrt(5.0)))
+	assert.True(RuleOfThirds.Weight(thirdsLine, 0.8, 0) > RuleOfThirds.Weight(phiLine, 0.8, 0))
+	assert.True(GoldenRatio.Weight(phiLine, 0.8, 0) > GoldenRatio.Weight(thirdsLine, 0.8, 0))
+	assert.True(GoldenRatio.Weight(phiLine, 0.8, 0) > CenterWeighted.Weight(phiLine, 0.8, 0))
+
+	// center weighting falls off monotonically
+	for p := 0.1; p <= 1.0; p += 0.1 {
+		assert.True(CenterWeighted.Weight(p, p, 0) < CenterWeighted.Weight(p-0.1, p-0.1, 0))
+	}
+}
+
+func TestCompositionScores(t *testing.T) {
+	assert := assert.New(t)
+
+	f := &features{RGBA: gradient(120, 80)}
+	crop := Crop{Rectangle: f.Rect.Inset(10)}
+	thirds := score(f, crop, RuleOfThirds)
+	none := score(f, crop, NoComposition)
+	assert.NotEqual(thirds, none)
+
+	// the thirds rule reproduces the scores of the original importance function
+	var want Score
+	for y := 0; y <= 80-scoreDownSample; y += scoreDownSample {
+		for x := 0; x <= 120-scoreDownSample; x += scoreDownSample {
+			imp := outsideImportance
+			if image.Pt(x, y).In(crop.Rectangle) {
+				xf := float64(x-crop.Min.X) / float64(crop.Dx())
+				yf := float64(y-crop.Min.Y) / float64(crop.Dy())
+				px, py := math.Abs(0.5-xf)*2.0, math.Abs(0.5-yf)*2.0
+				dx, dy := math.Max(px-1.0+edgeRadius, 0.0), math.Max(py-1.0+edgeRadius, 0.0)
+				d := (dx*dx + dy*dy) * edgeWeight
+				imp = baselineThirds(px, py, d) + d
+			}
+			c := f.RGBAAt(x, y)
+			det := float64(c.G) / 255.0
+			want.Skin += float64(c.R) / 255.0 * (det + skinBias) * imp
+			want.Detail += det * imp
+			want.Saturation += float64(c.B) / 255.0 * (det + saturationBias) * imp
+		}
+	}
+	assert.InDelta(want.Detail, thirds.Detail, 1e-6)
+	assert.InDelta(want.Skin, thirds.Skin, 1e-6)
+	assert.InDelta(want.Saturation, thirds.Saturation, 1e-6)
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"image"
 	"image/color"
+	"image/gif"
+	"io"
 	"math"
 	"time"
 
@@ -16,6 +18,24 @@ import (
 var (
 	// ErrInvalidDimensions gets returned when the supplied dimensions are invalid
 	ErrInvalidDimensions = errors.New("Expect either a height or width")
+	// ErrInvalidComponents gets returned when BlurHash components are outside 1 to 9
+	ErrInvalidComponents = errors.New("BlurHash components must be between 1 and 9")
+	// ErrUnsupportedFormat gets wrapped in a DecodeError when the input is not in a known format
+	ErrUnsupportedFormat = errors.New("Unsupported image format")
+	// ErrCorruptImage gets wrapped in a DecodeError when the input cannot be decoded
+	ErrCorruptImage = errors.New("Corrupt image data")
+	// ErrFrameSize gets returned when the frames of a sequence differ in size
+	ErrFrameSize = errors.New("All frames must have the same size")
+	// ErrUnknownEncoding gets returned when an Encoder is requested for an unknown format
+	ErrUnknownEncoding = errors.New("Unknown image type")
+	// ErrUnsupportedOption gets returned when an encoder option is not supported by the format
+	ErrUnsupportedOption = errors.New("Encoder option not supported")
+	// ErrImageTooLarge gets wrapped in a LimitError when an input exceeds the configured limits
+	ErrImageTooLarge = errors.New("Image too large")
+	// ErrInvalidSizeSpec gets wrapped in a SizeSpecError when a size spec cannot be parsed
+	ErrInvalidSizeSpec = errors.New("Invalid size spec")
+	// ErrInvalidMetadata gets returned when Metadata.EXIF is not an EXIF APP1 payload
+	ErrInvalidMetadata = errors.New("Invalid EXIF metadata")
 
 	skinColor = [3]float64{0.78, 0.57, 0.44}
 )
@@ -40,9 +60,36 @@ const (
 	edgeRadius              = 0.4
 	edgeWeight              = -20.0
 	outsideImportance       = -0.5
-	ruleOfThirds            = true
 	prescale                = true
 	prescaleMin             = 400.00
+	borderTolerance         = 24.0
+	borderCoverage          = 0.98
+	borderMinContent        = 0.25
+	focusWindow             = 16
+	focusWeight             = 0.5
+	focusMinVariance        = 4.0
+	productBorder           = 0.02
+	productTolerance        = 16.0
+	productCoverage         = 0.9
+	productNoise            = 0.005
+	productMaxSubject       = 0.98
+	fitBlurDownSample       = 16
+	zoomWeight              = 0.5
+	saliencySize            = 64
+	saliencyWeight          = 0.5
+	saliencyBlurPasses      = 3
+	entropyWindow           = 8
+	entropyBins             = 32
+	paletteMergeDistance    = 4.0
+	blurHashX               = 4
+	blurHashY               = 3
+	lqipSize                = 16
+	lqipQuality             = 40
+	gifSampleFrames         = 8
+	sequenceMovePenalty     = 2.0
+	sceneCutThreshold       = 0.5
+	sceneHistogramBins      = 32
+	jpegQuality             = 90
 )
 
 // Analyzer interface analyzes a image.Image and returns the best possible crop with the given
@@ -50,98 +97,314 @@ const (
 type Analyzer interface {
 	FindBestCrop(img image.Image, width, height int) (image.Rectangle, error)
 	FindBestCropWithFaces(img image.Image, width, height int, faces []image.Rectangle) (image.Rectangle, error)
+	Analyze(img image.Image, width, height int, opts Options) (Result, error)
+	FindProductCrop(img image.Image, width, height int, padding float64) (Result, error)
+	Fit(img image.Image, width, height int, mustInclude []image.Rectangle) (Layout, error)
+	AnalyzeReader(r io.Reader, width, height int, opts Options) (Result, error)
+	DecodeAndFindBestCrop(r io.Reader, width, height int) (image.Rectangle, string, error)
+	CropGIF(g *gif.GIF, width, height int, opts GIFOptions) (*gif.GIF, image.Rectangle, error)
+	FindCropPath(frames FrameIterator, width, height int, opts SequenceOptions) ([]image.Rectangle, error)
+	WriteCrop(w io.Writer, img image.Image, width, height int, opts Options, enc Encoder) (Result, error)
+	AnalyzeSize(img image.Image, size SizeSpec, opts Options) (Result, error)
+	AnalyzeReaderSize(r io.Reader, size SizeSpec, opts Options) (Result, error)
+}
+
+// Codec decodes inputs within the limits of a Config and writes analysis results, the
+// Analyzer returned by NewAnalyzer implements it as well
+type Codec interface {
+	// Decode decodes r like AnalyzeReader and returns the image as displayed along with
+	// the name of its format
+	Decode(r io.Reader) (image.Image, string, error)
+	// WriteResult writes the crop (or layout) of res taken from img, resized to the
+	// result size, to w using enc
+	WriteResult(w io.Writer, img image.Image, res Result, enc Encoder) error
 }
 
 // Score contains values that classify matches
 type Score struct {
-	Detail     float64
-	Saturation float64
-	Skin       float64
+	Detail     float64 `json:"detail"`
+	Saturation float64 `json:"saturation"`
+	Skin       float64 `json:"skin"`
+	Focus      float64 `json:"focus"`
+	Saliency   float64 `json:"saliency"`
+	Entropy    float64 `json:"entropy"`
 }
 
 // Crop contains results
 type Crop struct {
 	image.Rectangle
 	Score Score
+	// zoom is how far the crop was scaled below minScale, zero for regular crops
+	zoom float64
 }
 
 // Config is used to setup a new analyzer
 type Config struct {
+	// Debug logs analysis details to Logger, a new logger.Logger when nil, and writes
+	// debug images to the working directory
 	Debug  bool
 	Logger *logger.Logger
+	// TrimBorders detects uniform margins such as letterbox bars or scan borders and
+	// only generates crops inside the remaining content area
+	TrimBorders bool
+	// BorderTolerance is the maximum per channel difference (0-255) from the margin
+	// color for a pixel to count as border, zero means the default tolerance
+	BorderTolerance float64
+	// DetectFocus enables the sharpness detector which favors in focus regions over
+	// busy but blurred backgrounds
+	DetectFocus bool
+	// DetectSaliency enables the spectral residual saliency detector which finds visually
+	// distinct objects that edges and saturation miss
+	DetectSaliency bool
+	// Composition is the default composition rule, RuleOfThirds when nil
+	Composition CompositionRule
+	// MinZoom is the smallest crop scale relative to the largest possible crop, lowering
+	// it (e.g. to 0.25) allows tight crops of small subjects, zero means minScale. Crops
+	// below minScale are penalized in proportion to how far they zoom in.
+	MinZoom float64
+	// Strategy selects how crops are chosen, StrategyAttention by default
+	Strategy Strategy
+	// MaxUpscale limits how much smaller than the requested size a crop may be, 1 (the
+	// default) never requires upscaling the crop
+	MaxUpscale float64
+	// MaxBytes, MaxWidth, MaxHeight and MaxPixels limit the inputs accepted by the reader
+	// based entry points, they are checked before the image gets decoded. Zero means no limit.
+	MaxBytes  int64
+	MaxWidth  int
+	MaxHeight int
+	MaxPixels int64
+}
+
+// Options are per call settings for Analyze
+type Options struct {
+	// Faces, when given, restricts the result to crops containing all faces
+	Faces []image.Rectangle
+	// Composition overrides the analyzer's composition rule for this call
+	Composition CompositionRule
+	// Palette is the number of dominant colors to extract from the chosen crop, zero
+	// disables palette extraction
+	Palette int
+	// BlurHash enables the BlurHash placeholder for the chosen crop
+	BlurHash bool
+	// LQIP enables a tiny base64 encoded JPEG placeholder for the chosen crop
+	LQIP bool
+	// Hash enables perceptual hashes of the source image and the chosen crop
+	Hash bool
+}
+
+// Result contains the best crop along with details gathered during analysis
+type Result struct {
+	// Crop is the best crop in source image coordinates
+	Crop image.Rectangle
+	// Bounds are the bounds of the analyzed source image
+	Bounds image.Rectangle
+	// Width and Height are the output size the crop was chosen for
+	Width  int
+	Height int
+	// Score is the score of the best crop, measured on the prescaled image
+	Score Score
+	// Content is the area of the source image without detected borders, it is the
+	// full image when border trimming is disabled or no borders were found
+	Content image.Rectangle
+	// Subject is the bounding box of the foreground object found in product mode, it is
+	// empty when the standard analyzer was used
+	Subject image.Rectangle
+	// Background is the background color estimated in product mode, nil otherwise
+	Background color.Color
+	// Layout is set when no crop of the requested aspect ratio keeps the subject, Crop is
+	// then the whole image and WriteResult letterboxes it as described by the layout
+	Layout *Layout
+	// Palette holds the dominant colors of the crop ordered by coverage when requested
+	Palette []PaletteColor
+	// BlurHash is the BlurHash of the crop when requested
+	BlurHash string
+	// LQIP is a base64 encoded low quality JPEG of the crop when requested
+	LQIP string
+	// SourceHash and CropHash are perceptual hashes of the source image and the crop
+	// when requested
+	SourceHash Hash
+	CropHash   Hash
+	// Orientation is the EXIF orientation (1-8) applied before analysis, zero when the
+	// image was not read by AnalyzeReader
+	Orientation int
+	// Format is the name of the decoded image format, empty unless read from an io.Reader
+	Format string
+	// RawCrop is Crop mapped back to the pixel layout stored in the file, it equals Crop
+	// when no orientation was applied
+	RawCrop image.Rectangle
 }
 
 type analyzer struct {
-	debug  bool
-	logger *logger.Logger
+	debug           bool
+	logger          *logger.Logger
+	trimBorders     bool
+	borderTolerance float64
+	detectFocus     bool
+	detectSaliency  bool
+	composition     CompositionRule
+	minZoom         float64
+	maxUpscale      float64
+	strategy        Strategy
+	maxBytes        int64
+	maxWidth        int
+	maxHeight       int
+	maxPixels       int64
 	Resizer
 }
 
+// NewCodec returns a new Codec for the given Config
+func NewCodec(conf Config) Codec {
+	return NewAnalyzer(conf).(Codec)
+}
+
 // NewAnalyzer returns a new Analyzer using the given Resizer.
 func NewAnalyzer(conf Config) Analyzer {
-	return &analyzer{debug: conf.Debug, logger: conf.Logger, Resizer: NewDefaultResizer()}
+	a := &analyzer{
+		debug:           conf.Debug,
+		logger:          conf.Logger,
+		trimBorders:     conf.TrimBorders,
+		borderTolerance: conf.BorderTolerance,
+		detectFocus:     conf.DetectFocus,
+		detectSaliency:  conf.DetectSaliency,
+		composition:     conf.Composition,
+		minZoom:         conf.MinZoom,
+		maxUpscale:      conf.MaxUpscale,
+		strategy:        conf.Strategy,
+		maxBytes:        conf.MaxBytes,
+		maxWidth:        conf.MaxWidth,
+		maxHeight:       conf.MaxHeight,
+		maxPixels:       conf.MaxPixels,
+		Resizer:         NewDefaultResizer(),
+	}
+	if a.borderTolerance <= 0 {
+		a.borderTolerance = borderTolerance
+	}
+	if a.composition == nil {
+		a.composition = RuleOfThirds
+	}
+	if a.minZoom <= 0 {
+		a.minZoom = minScale
+	}
+	if a.maxUpscale < 1 {
+		a.maxUpscale = 1
+	}
+	if a.debug && a.logger == nil {
+		a.logger = logger.New()
+	}
+	return a
 }
 
 func (a analyzer) FindBestCrop(img image.Image, width, height int) (image.Rectangle, error) {
+	res, err := a.Analyze(img, width, height, Options{})
+	return res.Crop, err
+}
+
+func (a analyzer) FindBestCropWithFaces(img image.Image, width, height int, faces []image.Rectangle) (image.Rectangle, error) {
+	res, err := a.Analyze(img, width, height, Options{Faces: faces})
+	return res.Crop, err
+}
+
+func (a analyzer) Analyze(img image.Image, width, height int, opts Options) (Result, error) {
+	return a.analyzeImage(img, width, height, opts, true)
+}
+
+// analyzeImage analyzes img for a width x height output, without search the whole image is
+// the crop and only the extras requested by opts get computed
+func (a analyzer) analyzeImage(img image.Image, width, height int, opts Options, search bool) (Result, error) {
 	if width == 0 && height == 0 {
-		return image.Rectangle{}, ErrInvalidDimensions
+		return Result{}, ErrInvalidDimensions
 	}
 
 	// resize image for faster processing
-	scale := math.Min(float64(img.Bounds().Dx())/float64(width), float64(img.Bounds().Dy())/float64(height))
-	var lowimg *image.RGBA
-	var prescalefactor = 1.0
+	lowimg, cies, prescalefactor := a.prescale(img)
 
-	if prescale {
-		if f := prescaleMin / math.Min(float64(img.Bounds().Dx()), float64(img.Bounds().Dy())); f < 1.0 {
-			prescalefactor = f
+	res := Result{Bounds: img.Bounds(), Width: width, Height: height, Content: img.Bounds()}
+	if !search {
+		res.Crop, res.RawCrop = img.Bounds(), img.Bounds()
+		return res, a.extras(&res, lowimg, lowimg.Bounds(), opts)
+	}
+
+	content := lowimg.Bounds()
+	contentWidth, contentHeight := float64(img.Bounds().Dx()), float64(img.Bounds().Dy())
+	if a.trimBorders {
+		content = detectBorders(lowimg, a.borderTolerance)
+		if content != lowimg.Bounds() {
+			res.Content = scaleRect(content, prescalefactor)
+			contentWidth, contentHeight = float64(res.Content.Dx()), float64(res.Content.Dy())
 		}
 		if a.debug {
-			a.logger.Infof("prescale factor: %.2f", prescalefactor)
+			a.logger.Infof("content area: %v", res.Content)
 		}
-		smallimg := a.Resize(img, uint(float64(img.Bounds().Dx())*prescalefactor), 0)
-		lowimg = toRGBA(smallimg)
-	} else {
-		lowimg = toRGBA(img)
 	}
 
-	if a.debug {
-		writeImage("png", lowimg, "./smartcrop_prescale.png")
-	}
-
-	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
-	realMinScale := math.Min(maxScale, math.Max(1.0/scale, minScale))
-
 	if a.debug {
 		a.logger.Infof("original resolution: %dx%d\n", img.Bounds().Dx(), img.Bounds().Dy())
-		a.logger.Infof("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, cropWidth, cropHeight, realMinScale)
 	}
+	s := a.newSearch(width, height, contentWidth, contentHeight, prescalefactor, content, opts)
 
-	topCrop, err := a.analyze(lowimg, cropWidth, cropHeight, realMinScale)
-	if err != nil {
-		return topCrop, err
+	var topCrop Crop
+	var err error
+	var faces image.Rectangle
+	if len(opts.Faces) > 0 {
+		faces = getFacesRect(lowimg.Bounds(), img.Bounds(), opts.Faces).Intersect(content)
+	}
+	switch {
+	case a.strategy == StrategyEntropy:
+		topCrop = a.analyzeEntropy(lowimg, cies, s, faces)
+	case a.strategy != StrategyAttention:
+		topCrop = Crop{Rectangle: shiftOnto(fixedCrop(s, a.strategy).Rectangle, faces, content)}
+	case len(opts.Faces) > 0:
+		topCrop, err = a.analyzeWithFaces(lowimg, cies, s, img.Bounds(), opts.Faces)
+	default:
+		topCrop, err = a.analyze(lowimg, cies, s)
 	}
-
-	if prescale == true {
-		topCrop.Min.X = int(chop(float64(topCrop.Min.X) / prescalefactor))
-		topCrop.Min.Y = int(chop(float64(topCrop.Min.Y) / prescalefactor))
-		topCrop.Max.X = int(chop(float64(topCrop.Max.X) / prescalefactor))
-		topCrop.Max.Y = int(chop(float64(topCrop.Max.Y) / prescalefactor))
+	if err != nil {
+		return res, err
 	}
 
-	return topCrop.Canon(), nil
+	res.Crop = scaleRect(topCrop.Rectangle, prescalefactor).Canon()
+	res.RawCrop = res.Crop
+	res.Score = topCrop.Score
+	return res, a.extras(&res, lowimg, topCrop.Rectangle, opts)
 }
 
-func (a analyzer) FindBestCropWithFaces(img image.Image, width, height int, faces []image.Rectangle) (image.Rectangle, error) {
-	if width == 0 && height == 0 {
-		return image.Rectangle{}, ErrInvalidDimensions
+// extras fills in the palette, placeholders and hashes requested by opts for the crop r of
+// the prescaled image lowimg
+func (a analyzer) extras(res *Result, lowimg *image.RGBA, r image.Rectangle, opts Options) error {
+	var err error
+	if opts.Palette > 0 {
+		res.Palette = palette(lowimg, r, opts.Palette)
 	}
+	if opts.BlurHash {
+		if res.BlurHash, err = EncodeBlurHash(lowimg.SubImage(r), blurHashX, blurHashY); err != nil {
+			return err
+		}
+	}
+	if opts.LQIP {
+		if res.LQIP, err = a.lqip(lowimg.SubImage(r)); err != nil {
+			return err
+		}
+	}
+	if opts.Hash {
+		res.SourceHash = hash(a.Resizer, lowimg)
+		res.CropHash = hash(a.Resizer, lowimg.SubImage(r))
+	}
+	return nil
+}
 
-	// resize image for faster processing
-	scale := math.Min(float64(img.Bounds().Dx())/float64(width), float64(img.Bounds().Dy())/float64(height))
-	var lowimg *image.RGBA
+// prescale downsamples img for faster processing and returns it along with its luminance
+// and the factor used. The resizer works on the source type directly, so only the small
+// image gets converted to RGBA and the luminance is taken from the resized source.
+func (a analyzer) prescale(img image.Image) (*image.RGBA, []float64, float64) {
+	var smallimg image.Image
 	var prescalefactor = 1.0
 
+	// oriented images get prescaled as stored and only the small copy is transformed
+	oriented, _ := img.(*orientedImage)
+	if oriented != nil {
+		img = oriented.img
+	}
+
 	if prescale {
 		if f := prescaleMin / math.Min(float64(img.Bounds().Dx()), float64(img.Bounds().Dy())); f < 1.0 {
 			prescalefactor = f
@@ -149,41 +412,39 @@ func (a analyzer) FindBestCropWithFaces(img image.Image, width, height int, face
 		if a.debug {
 			a.logger.Infof("prescale factor: %.2f", prescalefactor)
 		}
-		smallimg := a.Resize(img, uint(float64(img.Bounds().Dx())*prescalefactor), 0)
-		lowimg = toRGBA(smallimg)
+		smallimg = a.Resize(img, uint(float64(img.Bounds().Dx())*prescalefactor), 0)
 	} else {
-		lowimg = toRGBA(img)
+		smallimg = img
 	}
-
-	if a.debug {
-		writeImage("png", lowimg, "./smartcrop_prescale.png")
+	lowimg := toRGBA(smallimg)
+	if oriented != nil {
+		lowimg = orientRGBA(lowimg, oriented.o)
+		smallimg = lowimg
 	}
-
-	cropWidth, cropHeight := chop(float64(width)*scale*prescalefactor), chop(float64(height)*scale*prescalefactor)
-	realMinScale := math.Min(maxScale, math.Max(1.0/scale, minScale))
+	cies := luminance(smallimg, lowimg)
 
 	if a.debug {
-		a.logger.Infof("original resolution: %dx%d\n", img.Bounds().Dx(), img.Bounds().Dy())
-		a.logger.Infof("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, cropWidth, cropHeight, realMinScale)
-	}
-
-	topCrop, err := a.analyzeWithFaces(lowimg, cropWidth, cropHeight, realMinScale, img.Bounds(), faces)
-	if err != nil {
-		return topCrop, err
+		writeImage("png", lowimg, "./smartcrop_prescale.png")
 	}
 
-	if prescale == true {
-		topCrop.Min.X = int(chop(float64(topCrop.Min.X) / prescalefactor))
-		topCrop.Min.Y = int(chop(float64(topCrop.Min.Y) / prescalefactor))
-		topCrop.Max.X = int(chop(float64(topCrop.Max.X) / prescalefactor))
-		topCrop.Max.Y = int(chop(float64(topCrop.Max.Y) / prescalefactor))
-	}
+	return lowimg, cies, prescalefactor
+}
 
-	return topCrop.Canon(), nil
+// scaleRect maps a rectangle on the prescaled image back to the source image
+func scaleRect(r image.Rectangle, prescalefactor float64) image.Rectangle {
+	return image.Rect(
+		int(chop(float64(r.Min.X)/prescalefactor)),
+		int(chop(float64(r.Min.Y)/prescalefactor)),
+		int(chop(float64(r.Max.X)/prescalefactor)),
+		int(chop(float64(r.Max.Y)/prescalefactor)),
+	)
 }
 
+// totalScore returns the weighted score per pixel, crops zoomed in below minScale lose
+// the zoomWeight fraction of their score per unit of zoom
 func (c Crop) totalScore() float64 {
-	return (c.Score.Detail*detailWeight + c.Score.Skin*skinWeight + c.Score.Saturation*saturationWeight) / float64(c.Dx()) / float64(c.Dy())
+	score := (c.Score.Detail*detailWeight + c.Score.Skin*skinWeight + c.Score.Saturation*saturationWeight + c.Score.Focus*focusWeight + c.Score.Saliency*saliencyWeight) / float64(c.Dx()) / float64(c.Dy())
+	return score - math.Abs(score)*c.zoom*zoomWeight
 }
 
 func chop(x float64) float64 {
@@ -193,16 +454,11 @@ func chop(x float64) float64 {
 	return math.Floor(x)
 }
 
-func thirds(x float64) float64 {
-	x = (math.Mod(x-(1.0/3.0)+1.0, 2.0)*0.5 - 0.5) * 16.0
-	return math.Max(1.0-x*x, 0.0)
-}
-
 func bounds(l float64) float64 {
 	return math.Min(math.Max(l, 0.0), 255)
 }
 
-func importance(crop Crop, x, y int) float64 {
+func importance(crop Crop, x, y int, rule CompositionRule) float64 {
 	if crop.Min.X > x || x >= crop.Max.X || crop.Min.Y > y || y >= crop.Max.Y {
 		return outsideImportance
 	}
@@ -217,15 +473,11 @@ func importance(crop Crop, x, y int) float64 {
 	dy := math.Max(py-1.0+edgeRadius, 0.0)
 	d := (dx*dx + dy*dy) * edgeWeight
 
-	s := 1.41 - math.Sqrt(px*px+py*py)
-	if ruleOfThirds {
-		s += (math.Max(0.0, s+d+0.5) * 1.2) * (thirds(px) + thirds(py))
-	}
-
-	return s + d
+	return rule.Weight(px, py, d) + d
 }
 
-func score(output *image.RGBA, crop Crop) Score {
+func score(f *features, crop Crop, rule CompositionRule) Score {
+	output := f.RGBA
 	width := output.Bounds().Dx()
 	height := output.Bounds().Dy()
 	score := Score{}
@@ -238,46 +490,121 @@ func score(output *image.RGBA, crop Crop) Score {
 			g8 := float64(c.G)
 			b8 := float64(c.B)
 
-			imp := importance(crop, int(x), int(y))
+			imp := importance(crop, int(x), int(y), rule)
 			det := g8 / 255.0
 
 			score.Skin += r8 / 255.0 * (det + skinBias) * imp
 			score.Detail += det * imp
 			score.Saturation += b8 / 255.0 * (det + saturationBias) * imp
+			if f.focus != nil {
+				score.Focus += float64(f.focus.GrayAt(x, y).Y) / 255.0 * imp
+			}
+			if f.saliency != nil {
+				score.Saliency += float64(f.saliency.GrayAt(x, y).Y) / 255.0 * imp
+			}
 		}
 	}
 
 	return score
 }
 
-func (a analyzer) analyze(img *image.RGBA, cropWidth, cropHeight, realMinScale float64) (image.Rectangle, error) {
+// features holds the detector outputs for an image, the embedded image contains skin in
+// red, edges in green and saturation in blue, optional detectors get their own plane
+type features struct {
+	*image.RGBA
+	focus    *image.Gray
+	saliency *image.Gray
+}
+
+// detect runs the feature detectors on img with luminance cies and returns their combined
+// output
+func (a analyzer) detect(img *image.RGBA, cies []float64) *features {
 	o := image.NewRGBA(img.Bounds())
+	f := &features{RGBA: o}
 
 	now := time.Now()
-	edgeDetect(img, o)
+	edgeDetect(cies, o)
 	if a.debug {
 		a.logger.Infoln("Time elapsed edge:", time.Since(now))
 	}
 	debugOutput(a.debug, o, "edge")
 
 	now = time.Now()
-	skinDetect(img, o)
+	skinDetect(img, cies, o)
 	if a.debug {
 		a.logger.Infoln("Time elapsed skin:", time.Since(now))
 	}
 	debugOutput(a.debug, o, "skin")
 
 	now = time.Now()
-	saturationDetect(img, o)
+	saturationDetect(img, cies, o)
 	if a.debug {
 		a.logger.Infoln("Time elapsed sat:", time.Since(now))
 	}
 	debugOutput(a.debug, o, "saturation")
 
-	now = time.Now()
+	if a.detectFocus {
+		now = time.Now()
+		f.focus = focusDetect(cies, img.Bounds().Dx(), img.Bounds().Dy())
+		if a.debug {
+			a.logger.Infoln("Time elapsed focus:", time.Since(now))
+			writeImage("png", f.focus, "./cropper_focus.png")
+		}
+	}
+
+	if a.detectSaliency {
+		now = time.Now()
+		f.saliency = saliencyDetect(cies, img.Bounds().Dx(), img.Bounds().Dy())
+		if a.debug {
+			a.logger.Infoln("Time elapsed saliency:", time.Since(now))
+			writeImage("png", f.saliency, "./cropper_saliency.png")
+		}
+	}
+
+	return f
+}
+
+// search describes the candidate crops to consider, sizes are in prescaled pixels
+type search struct {
+	cropWidth    float64
+	cropHeight   float64
+	realMinScale float64
+	content      image.Rectangle
+	composition  CompositionRule
+}
+
+// newSearch sets up the search for a width x height crop from a content area of
+// contentWidth x contentHeight source pixels, content is the same area on the prescaled image
+func (a analyzer) newSearch(width, height int, contentWidth, contentHeight, prescalefactor float64, content image.Rectangle, opts Options) search {
+	scale := math.Min(contentWidth/float64(width), contentHeight/float64(height))
+	s := search{
+		cropWidth:    chop(float64(width) * scale * prescalefactor),
+		cropHeight:   chop(float64(height) * scale * prescalefactor),
+		realMinScale: math.Min(maxScale, math.Max(1.0/(scale*a.maxUpscale), a.minZoom)),
+		content:      content,
+		composition:  a.composition,
+	}
+	if opts.Composition != nil {
+		s.composition = opts.Composition
+	}
+
+	if a.debug {
+		a.logger.Infof("scale: %f, cropw: %f, croph: %f, minscale: %f\n", scale, s.cropWidth, s.cropHeight, s.realMinScale)
+	}
+
+	return s
+}
+
+func (a analyzer) analyze(img *image.RGBA, cies []float64, s search) (Crop, error) {
+	return a.bestCrop(a.detect(img, cies), s)
+}
+
+// bestCrop scores every candidate crop against the detector output o
+func (a analyzer) bestCrop(o *features, s search) (Crop, error) {
+	now := time.Now()
 	var topCrop Crop
 	topScore := -1.0
-	cs := crops(o, cropWidth, cropHeight, realMinScale)
+	cs := crops(s.content, s.cropWidth, s.cropHeight, s.realMinScale)
 	if a.debug {
 		a.logger.Infoln("Time elapsed crops:", time.Since(now), len(cs))
 	}
@@ -285,7 +612,7 @@ func (a analyzer) analyze(img *image.RGBA, cropWidth, cropHeight, realMinScale f
 	now = time.Now()
 	for _, crop := range cs {
 		nowIter := time.Now()
-		crop.Score = score(o, crop)
+		crop.Score = score(o, crop, s.composition)
 		if a.debug {
 			a.logger.Infoln("Time elapsed single-score:", time.Since(nowIter))
 		}
@@ -296,45 +623,29 @@ func (a analyzer) analyze(img *image.RGBA, cropWidth, cropHeight, realMinScale f
 	}
 	if a.debug {
 		a.logger.Infoln("Time elapsed score:", time.Since(now))
-		drawDebugCrop(topCrop, o)
-		debugOutput(true, o, "final")
+		drawDebugCrop(topCrop, o.RGBA, s.composition)
+		debugOutput(true, o.RGBA, "final")
 	}
 
-	return topCrop.Rectangle, nil
+	return topCrop, nil
 }
 
+// getFacesRect returns the bounding box of faces, given in origRect coordinates, mapped onto
+// r and rounded outwards so the box never loses a pixel of a face
 func getFacesRect(r image.Rectangle, origRect image.Rectangle, faces []image.Rectangle) image.Rectangle {
-	var minX, minY, maxX, maxY int
-	for idx, face := range faces {
-		if idx == 0 {
-			minX = face.Min.X
-			minY = face.Min.Y
-			maxX = face.Max.X
-			maxY = face.Max.Y
-		} else {
-			if face.Min.X < minX {
-				minX = face.Min.X
-			}
-			if face.Min.Y < minY {
-				minY = face.Min.Y
-			}
-			if face.Max.X > maxX {
-				maxX = face.Max.X
-			}
-			if face.Max.X > maxX {
-				maxY = face.Max.Y
-			}
-		}
-	}
-
-	xMinT := r.Max.X * minX / origRect.Max.X
-	yMinT := r.Max.Y * minY / origRect.Max.Y
-	xMaxT := r.Max.X * maxX / origRect.Max.X
-	yMaxT := r.Max.Y * maxY / origRect.Max.Y
-
-	min := image.Point{X: xMinT, Y: yMinT}
-	max := image.Point{X: xMaxT, Y: yMaxT}
-	return image.Rectangle{Min: min, Max: max}
+	var union image.Rectangle
+	for _, face := range faces {
+		union = union.Union(face)
+	}
+
+	sx := float64(r.Dx()) / float64(origRect.Dx())
+	sy := float64(r.Dy()) / float64(origRect.Dy())
+	return image.Rect(
+		r.Min.X+int(math.Floor(float64(union.Min.X-origRect.Min.X)*sx)),
+		r.Min.Y+int(math.Floor(float64(union.Min.Y-origRect.Min.Y)*sy)),
+		r.Min.X+int(math.Ceil(float64(union.Max.X-origRect.Min.X)*sx)),
+		r.Min.Y+int(math.Ceil(float64(union.Max.Y-origRect.Min.Y)*sy)),
+	)
 }
 
 func centerPoint(r image.Rectangle) image.Point {
@@ -349,33 +660,13 @@ func distance(p1, p2 image.Point) float64 {
 	return math.Sqrt(first + second)
 }
 
-func (a analyzer) analyzeWithFaces(img *image.RGBA, cropWidth, cropHeight, realMinScale float64, origRect image.Rectangle, faces []image.Rectangle) (image.Rectangle, error) {
-	o := image.NewRGBA(img.Bounds())
-	now := time.Now()
-	edgeDetect(img, o)
-	if a.debug {
-		a.logger.Infoln("Time elapsed edge:", time.Since(now))
-	}
-	debugOutput(a.debug, o, "edge")
-
-	now = time.Now()
-	skinDetect(img, o)
-	if a.debug {
-		a.logger.Infoln("Time elapsed skin:", time.Since(now))
-	}
-	debugOutput(a.debug, o, "skin")
-
-	now = time.Now()
-	saturationDetect(img, o)
-	if a.debug {
-		a.logger.Infoln("Time elapsed sat:", time.Since(now))
-	}
-	debugOutput(a.debug, o, "saturation")
+func (a analyzer) analyzeWithFaces(img *image.RGBA, cies []float64, s search, origRect image.Rectangle, faces []image.Rectangle) (Crop, error) {
+	o := a.detect(img, cies)
 
-	now = time.Now()
+	now := time.Now()
 	var topCrop Crop
 	topScore := -10000.0
-	cs := crops(o, cropWidth, cropHeight, realMinScale)
+	cs := crops(s.content, s.cropWidth, s.cropHeight, s.realMinScale)
 	if a.debug {
 		a.logger.Infoln("Time elapsed crops:", time.Since(now), len(cs))
 	}
@@ -388,13 +679,15 @@ func (a analyzer) analyzeWithFaces(img *image.RGBA, cropWidth, cropHeight, realM
 	}
 	for _, crop := range cs {
 		nowIter := time.Now()
-		crop.Score = score(o, crop)
+		crop.Score = score(o, crop, s.composition)
 		if a.debug {
 			a.logger.Infof("Crop: %+v", crop)
 			a.logger.Infoln("Time elapsed single-score:", time.Since(nowIter))
 		}
 		tScore := crop.totalScore()
-		a.logger.Infof("%.6f", tScore)
+		if a.debug {
+			a.logger.Infof("%.6f", tScore)
+		}
 		if len(faces) > 0 {
 			if !faceRect.In(crop.Rectangle) {
 				continue
@@ -408,16 +701,16 @@ func (a analyzer) analyzeWithFaces(img *image.RGBA, cropWidth, cropHeight, realM
 	if a.debug {
 		a.logger.Infof("Final score: %.6f", topScore)
 		a.logger.Infoln("Time elapsed score:", time.Since(now))
-		drawDebugCrop(topCrop, o)
-		debugOutput(true, o, "final")
+		drawDebugCrop(topCrop, o.RGBA, s.composition)
+		debugOutput(true, o.RGBA, "final")
 	}
 
 	// check if we failed making a good choice from faces and math
 	if topCrop.Rectangle.Max.X == 0 && topCrop.Rectangle.Max.Y == 0 {
-		return a.analyze(img, cropWidth, cropHeight, realMinScale)
+		return a.analyze(img, cies, s)
 	}
 
-	return topCrop.Rectangle, nil
+	return topCrop, nil
 }
 
 func saturation(c color.RGBA) float64 {
@@ -457,6 +750,9 @@ func saturation(c color.RGBA) float64 {
 	return d / (maximum + minimum)
 }
 
+// cieMax is the largest value returned by cie, its weights add up to more than one
+const cieMax = (0.5126 + 0.7152 + 0.0722) * 255
+
 func cie(c color.RGBA) float64 {
 	return 0.5126*float64(c.B) + 0.7152*float64(c.G) + 0.0722*float64(c.R)
 }
@@ -488,10 +784,57 @@ func makeCies(img *image.RGBA) []float64 {
 	return cies
 }
 
-func edgeDetect(i *image.RGBA, o *image.RGBA) {
-	width := i.Bounds().Dx()
-	height := i.Bounds().Dy()
-	cies := makeCies(i)
+// luminance returns the cie luminance of src, rgba is src converted to RGBA. Gray images
+// use their pixels directly, which matches cie exactly, and 16 bit images keep their full
+// precision. Everything else, YCbCr included since its luma weights differ from cie, is
+// computed from rgba so the result never depends on how the image was stored.
+func luminance(src image.Image, rgba *image.RGBA) []float64 {
+	b := src.Bounds()
+	width, height := b.Dx(), b.Dy()
+	cies := make([]float64, 0, width*height)
+
+	switch img := src.(type) {
+	case *image.Gray:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				cies = append(cies, float64(img.Pix[img.PixOffset(x, y)])*cieMax/255.0)
+			}
+		}
+	case *image.Gray16:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				cies = append(cies, float64(img.Gray16At(x, y).Y)*cieMax/0xffff)
+			}
+		}
+	case *image.RGBA64:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := img.RGBA64At(x, y)
+				cies = append(cies, cie64(float64(c.R), float64(c.G), float64(c.B)))
+			}
+		}
+	case *image.NRGBA64:
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, _ := img.At(x, y).RGBA()
+				cies = append(cies, cie64(float64(r), float64(g), float64(bl)))
+			}
+		}
+	default:
+		return makeCies(rgba)
+	}
+
+	return cies
+}
+
+// cie64 is cie for premultiplied 16 bit channels
+func cie64(r, g, b float64) float64 {
+	return (0.5126*b + 0.7152*g + 0.0722*r) / 257.0
+}
+
+func edgeDetect(cies []float64, o *image.RGBA) {
+	width := o.Bounds().Dx()
+	height := o.Bounds().Dy()
 
 	var lightness float64
 	for y := 0; y < height; y++ {
@@ -513,13 +856,13 @@ func edgeDetect(i *image.RGBA, o *image.RGBA) {
 	}
 }
 
-func skinDetect(i *image.RGBA, o *image.RGBA) {
+func skinDetect(i *image.RGBA, cies []float64, o *image.RGBA) {
 	width := i.Bounds().Dx()
 	height := i.Bounds().Dy()
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			lightness := cie(i.RGBAAt(x, y)) / 255.0
+			lightness := cies[y*width+x] / 255.0
 			skin := skinCol(i.RGBAAt(x, y))
 
 			c := o.RGBAAt(x, y)
@@ -535,13 +878,13 @@ func skinDetect(i *image.RGBA, o *image.RGBA) {
 	}
 }
 
-func saturationDetect(i *image.RGBA, o *image.RGBA) {
+func saturationDetect(i *image.RGBA, cies []float64, o *image.RGBA) {
 	width := i.Bounds().Dx()
 	height := i.Bounds().Dy()
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			lightness := cie(i.RGBAAt(x, y)) / 255.0
+			lightness := cies[y*width+x] / 255.0
 			saturation := saturation(i.RGBAAt(x, y))
 
 			c := o.RGBAAt(x, y)
@@ -557,10 +900,10 @@ func saturationDetect(i *image.RGBA, o *image.RGBA) {
 	}
 }
 
-func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
+func crops(content image.Rectangle, cropWidth, cropHeight, realMinScale float64) []Crop {
 	res := []Crop{}
-	width := i.Bounds().Dx()
-	height := i.Bounds().Dy()
+	width := content.Dx()
+	height := content.Dy()
 
 	minDimension := math.Min(float64(width), float64(height))
 	var cropW, cropH float64
@@ -577,10 +920,11 @@ func crops(i image.Image, cropWidth, cropHeight, realMinScale float64) []Crop {
 	}
 
 	for scale := maxScale; scale >= realMinScale; scale -= scaleStep {
-		for y := 0; float64(y)+cropH*scale <= float64(height); y += step {
-			for x := 0; float64(x)+cropW*scale <= float64(width); x += step {
+		for y := content.Min.Y; float64(y)+cropH*scale <= float64(content.Max.Y); y += step {
+			for x := content.Min.X; float64(x)+cropW*scale <= float64(content.Max.X); x += step {
 				res = append(res, Crop{
 					Rectangle: image.Rect(x, y, x+int(cropW*scale), y+int(cropH*scale)),
+					zoom:      math.Max(0.0, minScale-scale),
 				})
 			}
 		}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
 	"io/ioutil"
@@ -145,6 +146,66 @@ func TestCropWithFaces(t *testing.T) {
 
 }
 
+// smallSubject returns a flat gray image with a saturated checkerboard in r
+func smallSubject(width, height int, r image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{128, 128, 128, 255}
+			if (image.Point{x, y}).In(r) {
+				c = color.RGBA{230, 20, 20, 255}
+				if (x/8+y/8)%2 == 0 {
+					c = color.RGBA{250, 240, 30, 255}
+				}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestZoomPenalty(t *testing.T) {
+	assert := assert.New(t)
+
+	c := Crop{Rectangle: image.Rect(0, 0, 10, 10), Score: Score{Detail: 100}}
+	plain := c.totalScore()
+	c.zoom = 0.4
+	assert.InDelta(plain*(1-0.4*zoomWeight), c.totalScore(), 1e-12)
+	c.Score.Detail = -100
+	assert.InDelta(-plain*(1+0.4*zoomWeight), c.totalScore(), 1e-12)
+}
+
+func TestMinZoom(t *testing.T) {
+	assert := assert.New(t)
+	subject := image.Rect(480, 480, 600, 600)
+	img := smallSubject(800, 800, subject)
+
+	res, err := NewAnalyzer(Config{}).Analyze(img, 200, 200, Options{})
+	assert.NoError(err)
+	assert.True(res.Crop.Dx() >= 700, "crop %v zoomed in without MinZoom", res.Crop)
+
+	res, err = NewAnalyzer(Config{MinZoom: 0.25, MaxUpscale: 1}).Analyze(img, 200, 200, Options{})
+	assert.NoError(err)
+	assert.True(res.Crop.Dx() < 400, "crop %v did not zoom in", res.Crop)
+	assert.True(res.Crop.Overlaps(subject), "crop %v misses %v", res.Crop, subject)
+	assert.True(res.Crop.Dx() >= 200, "crop %v needs upscaling", res.Crop)
+}
+
+func TestMaxUpscale(t *testing.T) {
+	assert := assert.New(t)
+	img := smallSubject(800, 800, image.Rect(480, 480, 540, 540))
+
+	for _, c := range []struct {
+		maxUpscale float64
+		min        int
+	}{{1, 400}, {2, 200}} {
+		res, err := NewAnalyzer(Config{MinZoom: 0.1, MaxUpscale: c.maxUpscale}).Analyze(img, 400, 400, Options{})
+		assert.NoError(err)
+		assert.True(res.Crop.Dx() >= c.min-2, "crop %v below %d with MaxUpscale %v", res.Crop, c.min, c.maxUpscale)
+		assert.True(res.Crop.Dx() < c.min+50, "crop %v did not zoom to %d with MaxUpscale %v", res.Crop, c.min, c.maxUpscale)
+	}
+}
+
 func BenchmarkCrop(b *testing.B) {
 	fi, err := os.Open(testFile)
 	if err != nil {
@@ -177,11 +238,11 @@ func BenchmarkEdge(b *testing.B) {
 		b.Fatal(err)
 	}
 
-	rgbaImg := toRGBA(img)
+	cies := luminance(img, toRGBA(img))
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		o := image.NewRGBA(img.Bounds())
-		edgeDetect(rgbaImg, o)
+		edgeDetect(cies, o)
 	}
 }
 
@@ -222,3 +283,44 @@ func BenchmarkImageDir(b *testing.B) {
 	}
 	// fmt.Println("average time/image:", b.t)
 }
+
+func TestLuminanceYCbCr(t *testing.T) {
+	assert := assert.New(t)
+
+	ycc := image.NewYCbCr(image.Rect(0, 0, 300, 200), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			yy, cb, cr := color.RGBToYCbCr(uint8(x*255/300), uint8(y), 40)
+			if (image.Point{x, y}).In(image.Rect(200, 60, 260, 140)) && (x/6+y/6)%2 == 0 {
+				yy, cb, cr = color.RGBToYCbCr(40, 220, 30)
+			}
+			ycc.Y[ycc.YOffset(x, y)], ycc.Cb[ycc.COffset(x, y)], ycc.Cr[ycc.COffset(x, y)] = yy, cb, cr
+		}
+	}
+	rgba := toRGBA(ycc)
+	assert.Equal(makeCies(rgba), luminance(ycc, rgba))
+
+	gray := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i)
+	}
+	assert.InDeltaSlice(makeCies(toRGBA(gray)), luminance(gray, toRGBA(gray)), 1e-9)
+
+	analyzer := NewAnalyzer(Config{})
+	want, err := analyzer.Analyze(rgba, 100, 100, Options{})
+	assert.NoError(err)
+	got, err := analyzer.Analyze(ycc, 100, 100, Options{})
+	assert.NoError(err)
+	assert.Equal(want.Crop, got.Crop)
+	assert.Equal(want.Score, got.Score)
+}
+
+func TestNewAnalyzerDebugLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NotNil(NewAnalyzer(Config{Debug: true}).(*analyzer).logger)
+	l := logger.New()
+	assert.Equal(l, NewAnalyzer(Config{Debug: true, Logger: l}).(*analyzer).logger)
+	_, ok := NewAnalyzer(Config{}).(Codec)
+	assert.True(ok)
+}
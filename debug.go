@@ -1,11 +1,8 @@
 package cropper
 
 import (
-	"errors"
 	"image"
 	"image/color"
-	"image/jpeg"
-	"image/png"
 	"os"
 	"path/filepath"
 )
@@ -21,37 +18,21 @@ func writeImage(imgtype string, img image.Image, name string) error {
 		panic(err)
 	}
 
-	switch imgtype {
-	case "png":
-		return writeImageToPng(img, name)
-	case "jpeg":
-		return writeImageToJpeg(img, name)
-	}
-
-	return errors.New("Unknown image type")
-}
-
-func writeImageToJpeg(img image.Image, name string) error {
-	fso, err := os.Create(name)
+	enc, err := NewEncoder(EncoderOptions{Format: imgtype, Quality: 100})
 	if err != nil {
 		return err
 	}
-	defer fso.Close()
-
-	return jpeg.Encode(fso, img, &jpeg.Options{Quality: 100})
-}
 
-func writeImageToPng(img image.Image, name string) error {
 	fso, err := os.Create(name)
 	if err != nil {
 		return err
 	}
 	defer fso.Close()
 
-	return png.Encode(fso, img)
+	return enc.Encode(fso, img)
 }
 
-func drawDebugCrop(topCrop Crop, o *image.RGBA) {
+func drawDebugCrop(topCrop Crop, o *image.RGBA, rule CompositionRule) {
 	width := o.Bounds().Dx()
 	height := o.Bounds().Dy()
 
@@ -62,7 +43,7 @@ func drawDebugCrop(topCrop Crop, o *image.RGBA) {
 			g8 := float64(g >> 8)
 			b8 := uint8(b >> 8)
 
-			imp := importance(topCrop, x, y)
+			imp := importance(topCrop, x, y, rule)
 
 			if imp > 0 {
 				g8 += imp * 32
@@ -0,0 +1,129 @@
+package cropper
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+
+	// register the supported formats with image.Decode
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// DecodeError is returned when an input image cannot be decoded. Err is either
+// ErrUnsupportedFormat or ErrCorruptImage, Cause is the error reported by the decoder.
+type DecodeError struct {
+	Format string
+	Err    error
+	Cause  error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Format == "" {
+		return fmt.Sprintf("%s: %s", e.Err, e.Cause)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Err, e.Format, e.Cause)
+}
+
+// Unwrap allows errors.Is to match ErrUnsupportedFormat and ErrCorruptImage
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// LimitError is returned when an input exceeds one of the limits in Config, it wraps
+// ErrImageTooLarge
+type LimitError struct {
+	// Limit names the exceeded limit: "bytes", "width", "height" or "pixels"
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s %d exceeds limit of %d", ErrImageTooLarge, e.Limit, e.Value, e.Max)
+}
+
+// Unwrap allows errors.Is to match ErrImageTooLarge
+func (e *LimitError) Unwrap() error {
+	return ErrImageTooLarge
+}
+
+// DecodeAndFindBestCrop decodes a JPEG, PNG, GIF, BMP, TIFF or WebP image from r and returns
+// the best crop in display coordinates (after applying EXIF orientation) along with the
+// name of the detected format
+func (a analyzer) DecodeAndFindBestCrop(r io.Reader, width, height int) (image.Rectangle, string, error) {
+	res, err := a.AnalyzeReader(r, width, height, Options{})
+	if err != nil {
+		var format string
+		if de, ok := err.(*DecodeError); ok {
+			format = de.Format
+		}
+		return image.Rectangle{}, format, err
+	}
+	return res.Crop, res.Format, nil
+}
+
+func (a analyzer) Decode(r io.Reader) (image.Image, string, error) {
+	img, format, orientation, err := a.readOriented(r)
+	if err != nil {
+		return nil, format, err
+	}
+	return orient(img, orientation), format, nil
+}
+
+// decode reads and decodes the image in r, it returns the raw bytes as well so metadata can
+// be parsed from them. The input limits are enforced before any pixels get decoded.
+func (a analyzer) decode(r io.Reader) (image.Image, string, []byte, error) {
+	if a.maxBytes > 0 {
+		r = io.LimitReader(r, a.maxBytes+1)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if a.maxBytes > 0 && int64(len(data)) > a.maxBytes {
+		return nil, "", nil, &LimitError{Limit: "bytes", Value: int64(len(data)), Max: a.maxBytes}
+	}
+
+	conf, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, "", data, &DecodeError{Err: ErrUnsupportedFormat, Cause: err}
+	}
+	if err != nil {
+		return nil, format, data, &DecodeError{Format: format, Err: ErrCorruptImage, Cause: err}
+	}
+	if err := a.checkLimits(conf); err != nil {
+		return nil, format, data, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, data, &DecodeError{Format: format, Err: ErrCorruptImage, Cause: err}
+	}
+	if a.debug {
+		a.logger.Infof("decoded %s image: %v", format, img.Bounds())
+	}
+
+	return img, format, data, nil
+}
+
+// checkLimits verifies the declared dimensions of an image against the configured limits
+func (a analyzer) checkLimits(conf image.Config) error {
+	if a.maxWidth > 0 && conf.Width > a.maxWidth {
+		return &LimitError{Limit: "width", Value: int64(conf.Width), Max: int64(a.maxWidth)}
+	}
+	if a.maxHeight > 0 && conf.Height > a.maxHeight {
+		return &LimitError{Limit: "height", Value: int64(conf.Height), Max: int64(a.maxHeight)}
+	}
+	if pixels := int64(conf.Width) * int64(conf.Height); a.maxPixels > 0 && pixels > a.maxPixels {
+		return &LimitError{Limit: "pixels", Value: pixels, Max: a.maxPixels}
+	}
+	return nil
+}
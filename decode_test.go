@@ -0,0 +1,61 @@
+package cropper
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeAndFindBestCrop(t *testing.T) {
+	assert := assert.New(t)
+	analyzer := NewAnalyzer(Config{})
+
+	var buf bytes.Buffer
+	assert.NoError(png.Encode(&buf, gradient(300, 200)))
+	data := buf.Bytes()
+
+	crop, format, err := analyzer.DecodeAndFindBestCrop(bytes.NewReader(data), 100, 100)
+	assert.NoError(err)
+	assert.Equal("png", format)
+	assert.False(crop.Empty())
+
+	_, _, err = analyzer.DecodeAndFindBestCrop(strings.NewReader("plain text"), 100, 100)
+	assert.True(errors.Is(err, ErrUnsupportedFormat), "unexpected error %v", err)
+
+	_, format, err = analyzer.DecodeAndFindBestCrop(bytes.NewReader(data[:len(data)/2]), 100, 100)
+	assert.True(errors.Is(err, ErrCorruptImage), "unexpected error %v", err)
+	assert.Equal("png", format)
+}
+
+func TestDecodeLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	assert.NoError(png.Encode(&buf, gradient(300, 200)))
+	data := buf.Bytes()
+
+	cases := []struct {
+		conf  Config
+		limit string
+	}{
+		{Config{MaxBytes: 100}, "bytes"},
+		{Config{MaxWidth: 299}, "width"},
+		{Config{MaxHeight: 199}, "height"},
+		{Config{MaxPixels: 300*200 - 1}, "pixels"},
+	}
+	for _, c := range cases {
+		_, _, err := NewAnalyzer(c.conf).DecodeAndFindBestCrop(bytes.NewReader(data), 100, 100)
+		assert.True(errors.Is(err, ErrImageTooLarge), "unexpected error %v", err)
+		if le, ok := err.(*LimitError); assert.True(ok) {
+			assert.Equal(c.limit, le.Limit)
+		}
+	}
+
+	limits := Config{MaxBytes: int64(len(data)), MaxWidth: 300, MaxHeight: 200, MaxPixels: 300 * 200}
+	_, _, err := NewAnalyzer(limits).DecodeAndFindBestCrop(bytes.NewReader(data), 100, 100)
+	assert.NoError(err)
+}
@@ -0,0 +1,132 @@
+package cropper
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Encoder writes images in a configured format. See NewEncoder for the implementation using
+// the standard library codecs.
+type Encoder interface {
+	Encode(w io.Writer, img image.Image) error
+	// Format returns the name of the written format
+	Format() string
+	// ContentType returns the MIME type of the written format
+	ContentType() string
+}
+
+// ChromaSubsampling selects the JPEG chroma subsampling
+type ChromaSubsampling int
+
+const (
+	// Subsampling420 halves the chroma resolution in both directions, this is the default
+	Subsampling420 ChromaSubsampling = iota
+	// Subsampling422 halves the chroma resolution horizontally
+	Subsampling422
+	// Subsampling444 keeps the full chroma resolution
+	Subsampling444
+)
+
+// EncoderOptions configure NewEncoder, options that do not apply to Format are ignored
+type EncoderOptions struct {
+	// Format is "jpeg", "png" or "gif"
+	Format string
+	// Quality is the JPEG quality from 1 to 100, zero means jpegQuality
+	Quality int
+	// CompressionLevel is the PNG compression level
+	CompressionLevel png.CompressionLevel
+	// Progressive requests a progressive JPEG
+	Progressive bool
+	// Subsampling is the JPEG chroma subsampling
+	Subsampling ChromaSubsampling
+	// Metadata is written into encoded JPEGs, see ReadMetadata
+	Metadata *Metadata
+	// StripGPS removes the GPS location from the EXIF data written with Metadata
+	StripGPS bool
+}
+
+type stdEncoder struct {
+	opts EncoderOptions
+}
+
+// NewEncoder creates a new Encoder for the given options. image/jpeg only writes baseline
+// 4:2:0 files, so asking for a progressive JPEG or another subsampling returns
+// ErrUnsupportedOption rather than silently producing something else.
+func NewEncoder(opts EncoderOptions) (Encoder, error) {
+	switch opts.Format {
+	case "jpeg", "jpg":
+		opts.Format = "jpeg"
+		if opts.Progressive || opts.Subsampling != Subsampling420 {
+			return nil, ErrUnsupportedOption
+		}
+		if opts.Quality <= 0 {
+			opts.Quality = jpegQuality
+		}
+		if opts.Quality > 100 {
+			opts.Quality = 100
+		}
+	case "png", "gif":
+	default:
+		return nil, ErrUnknownEncoding
+	}
+	return stdEncoder{opts: opts}, nil
+}
+
+// NewDefaultEncoder creates a new Encoder writing JPEGs with the default quality.
+func NewDefaultEncoder() Encoder {
+	return stdEncoder{opts: EncoderOptions{Format: "jpeg", Quality: jpegQuality}}
+}
+
+func (e stdEncoder) Encode(w io.Writer, img image.Image) error {
+	switch e.opts.Format {
+	case "png":
+		enc := png.Encoder{CompressionLevel: e.opts.CompressionLevel}
+		return enc.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	}
+	if e.opts.Metadata == nil {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: e.opts.Quality})
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: e.opts.Quality}); err != nil {
+		return err
+	}
+	return writeJPEGWithMetadata(w, buf.Bytes(), e.opts.Metadata, img.Bounds().Dx(), img.Bounds().Dy(), e.opts.StripGPS)
+}
+
+func (e stdEncoder) Format() string {
+	return e.opts.Format
+}
+
+func (e stdEncoder) ContentType() string {
+	return "image/" + e.opts.Format
+}
+
+// WriteCrop finds the best crop of img, resizes it to width x height (keeping the aspect
+// ratio if one of them is zero) and writes it to w using enc
+func (a analyzer) WriteCrop(w io.Writer, img image.Image, width, height int, opts Options, enc Encoder) (Result, error) {
+	res, err := a.Analyze(img, width, height, opts)
+	if err != nil {
+		return res, err
+	}
+	return res, a.WriteResult(w, img, res, enc)
+}
+
+func (a analyzer) WriteResult(w io.Writer, img image.Image, res Result, enc Encoder) error {
+	if res.Layout != nil {
+		fill := res.Background
+		if fill == nil {
+			fill = color.Black
+		}
+		return enc.Encode(w, res.Layout.Render(img, a.Resizer, FitSolid, fill))
+	}
+	out := a.Resize(subImage(img, res.Crop), uint(res.Width), uint(res.Height))
+	return enc.Encode(w, out)
+}
@@ -0,0 +1,63 @@
+package cropper
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEncoder(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewEncoder(EncoderOptions{Format: "jpeg", Progressive: true})
+	assert.Equal(ErrUnsupportedOption, err)
+	_, err = NewEncoder(EncoderOptions{Format: "jpeg", Subsampling: Subsampling444})
+	assert.Equal(ErrUnsupportedOption, err)
+	_, err = NewEncoder(EncoderOptions{Format: "webp"})
+	assert.Equal(ErrUnknownEncoding, err)
+	_, err = NewEncoder(EncoderOptions{})
+	assert.Equal(ErrUnknownEncoding, err)
+
+	enc, err := NewEncoder(EncoderOptions{Format: "jpg", Quality: 500})
+	assert.NoError(err)
+	assert.Equal("jpeg", enc.Format())
+	assert.Equal("image/jpeg", enc.ContentType())
+
+	enc, err = NewEncoder(EncoderOptions{Format: "png", CompressionLevel: png.BestCompression})
+	assert.NoError(err)
+	assert.Equal("image/png", enc.ContentType())
+}
+
+func TestWriteCrop(t *testing.T) {
+	assert := assert.New(t)
+	analyzer := NewAnalyzer(Config{})
+
+	for _, format := range []string{"jpeg", "png", "gif"} {
+		enc, err := NewEncoder(EncoderOptions{Format: format})
+		assert.NoError(err)
+
+		var buf bytes.Buffer
+		res, err := analyzer.WriteCrop(&buf, gradient(300, 200), 120, 50, Options{}, enc)
+		assert.NoError(err)
+		assert.False(res.Crop.Empty())
+
+		img, decoded, err := image.Decode(&buf)
+		assert.NoError(err)
+		assert.Equal(format, decoded)
+		assert.Equal(image.Rect(0, 0, 120, 50), img.Bounds(), format)
+	}
+
+	// lower quality writes smaller files
+	sizes := map[int]int{}
+	for _, quality := range []int{10, 95} {
+		enc, _ := NewEncoder(EncoderOptions{Format: "jpeg", Quality: quality})
+		var buf bytes.Buffer
+		_, err := analyzer.WriteCrop(&buf, gradient(300, 200), 120, 50, Options{}, enc)
+		assert.NoError(err)
+		sizes[quality] = buf.Len()
+	}
+	assert.True(sizes[10] < sizes[95], "sizes %v", sizes)
+}
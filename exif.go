@@ -0,0 +1,250 @@
+package cropper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	exifHeader         = "Exif\x00\x00"
+	exifOrientationTag = 0x0112
+)
+
+// AnalyzeReader decodes the image from r, applies its EXIF orientation so the analysis sees
+// the image as it is displayed, and returns the crop both in display coordinates (Crop) and
+// in the pixel layout stored in the file (RawCrop)
+func (a analyzer) AnalyzeReader(r io.Reader, width, height int, opts Options) (Result, error) {
+	img, format, orientation, err := a.readOriented(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return a.analyzeOriented(img, format, orientation, width, height, opts, true)
+}
+
+// readOriented decodes r and returns the stored image along with its format and EXIF orientation
+func (a analyzer) readOriented(r io.Reader) (image.Image, string, int, error) {
+	img, format, data, err := a.decode(r)
+	if err != nil {
+		return nil, format, 0, err
+	}
+
+	orientation := exifOrientation(data)
+	if a.debug {
+		a.logger.Infof("exif orientation: %d", orientation)
+	}
+	return img, format, orientation, nil
+}
+
+// analyzeOriented analyzes the stored image img as displayed with the given orientation
+func (a analyzer) analyzeOriented(img image.Image, format string, orientation, width, height int, opts Options, search bool) (Result, error) {
+	res, err := a.analyzeImage(orient(img, orientation), width, height, opts, search)
+	if err != nil {
+		return res, err
+	}
+	res.Format = format
+	res.Orientation = orientation
+	res.RawCrop = storedRect(res.Crop, orientation, img.Bounds())
+
+	return res, nil
+}
+
+// exifOrientation returns the orientation stored in the EXIF data of a JPEG file, 1 (no
+// transformation) if there is none or the data cannot be parsed
+func exifOrientation(data []byte) int {
+	tiff := exifSegment(data)
+	if tiff == nil {
+		return 1
+	}
+	order, ifd, ok := tiffHeader(tiff)
+	if !ok {
+		return 1
+	}
+	entry, ok := ifdEntry(tiff, order, ifd, exifOrientationTag)
+	if !ok {
+		return 1
+	}
+	if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// exifSegment returns the TIFF structure of the EXIF APP1 segment of a JPEG file
+func exifSegment(data []byte) []byte {
+	var tiff []byte
+	jpegSegments(data, func(marker byte, payload []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(payload, []byte(exifHeader)) {
+			tiff = payload[len(exifHeader):]
+			return false
+		}
+		return true
+	})
+	return tiff
+}
+
+// jpegSegments calls fn with the marker and payload of every segment in the header of a
+// JPEG file until fn returns false or the image data starts
+func jpegSegments(data []byte, fn func(marker byte, payload []byte) bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+	for pos := 2; pos+4 <= len(data); {
+		if data[pos] != 0xFF {
+			return
+		}
+		marker := data[pos+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			pos++
+			continue
+		}
+		// image data follows start of scan, metadata always comes before
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return
+		}
+		if !fn(marker, data[pos+4:end]) {
+			return
+		}
+		pos = end
+	}
+}
+
+// tiffHeader returns the byte order and the offset of the first IFD of a TIFF structure
+func tiffHeader(tiff []byte) (binary.ByteOrder, int, bool) {
+	if len(tiff) < 8 {
+		return nil, 0, false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, false
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, 0, false
+	}
+	return order, int(order.Uint32(tiff[4:])), true
+}
+
+// ifdEntry returns the offset of the 12 byte entry for tag in the IFD at offset ifd
+func ifdEntry(tiff []byte, order binary.ByteOrder, ifd int, tag uint16) (int, bool) {
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 0, false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0, false
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return entry, true
+		}
+	}
+	return 0, false
+}
+
+// orient returns img as displayed with the EXIF orientation o. The result is a view that
+// maps every pixel onto the stored image, the analysis prescales the stored pixels and only
+// transforms the small copy, so no full resolution copy of the image is made.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	return &orientedImage{img: img, o: o}
+}
+
+// orientedImage is the stored image img displayed with the orientation o
+type orientedImage struct {
+	img image.Image
+	o   int
+}
+
+func (o *orientedImage) ColorModel() color.Model {
+	return o.img.ColorModel()
+}
+
+func (o *orientedImage) Bounds() image.Rectangle {
+	b := o.img.Bounds()
+	if o.o >= 5 {
+		return image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	return image.Rect(0, 0, b.Dx(), b.Dy())
+}
+
+func (o *orientedImage) At(x, y int) color.Color {
+	b := o.img.Bounds()
+	sx, sy := storedPoint(x, y, o.o, b.Dx(), b.Dy())
+	return o.img.At(b.Min.X+sx, b.Min.Y+sy)
+}
+
+// orientRGBA returns a copy of src transformed as described by the EXIF orientation o
+func orientRGBA(src *image.RGBA, o int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ow, oh := w, h
+	if o >= 5 {
+		ow, oh = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < oh; y++ {
+		for x := 0; x < ow; x++ {
+			sx, sy := storedPoint(x, y, o, w, h)
+			si := src.PixOffset(b.Min.X+sx, b.Min.Y+sy)
+			copy(out.Pix[out.PixOffset(x, y):out.PixOffset(x, y)+4], src.Pix[si:si+4])
+		}
+	}
+	return out
+}
+
+// storedPoint maps the displayed pixel x, y to the stored pixel for orientation o of an
+// image stored with width w and height h
+func storedPoint(x, y, o, w, h int) (int, int) {
+	switch o {
+	case 2:
+		return w - 1 - x, y
+	case 3:
+		return w - 1 - x, h - 1 - y
+	case 4:
+		return x, h - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, h - 1 - x
+	case 7:
+		return w - 1 - y, h - 1 - x
+	case 8:
+		return w - 1 - y, x
+	}
+	return x, y
+}
+
+// storedRect maps a rectangle in display coordinates back to the stored pixel layout of an
+// image with the given stored bounds
+func storedRect(r image.Rectangle, o int, stored image.Rectangle) image.Rectangle {
+	if o <= 1 || o > 8 || r.Empty() {
+		return r
+	}
+	w, h := stored.Dx(), stored.Dy()
+	x0, y0 := storedPoint(r.Min.X, r.Min.Y, o, w, h)
+	x1, y1 := storedPoint(r.Max.X-1, r.Max.Y-1, o, w, h)
+	if x0 > x1 {
+		x0, x1 = x1, x0
+	}
+	if y0 > y1 {
+		y0, y1 = y1, y0
+	}
+	return image.Rect(x0, y0, x1+1, y1+1).Add(stored.Min)
+}
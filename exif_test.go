@@ -0,0 +1,89 @@
+package cropper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// withOrientation returns a JPEG of img carrying an EXIF orientation tag
+func withOrientation(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], exifOrientationTag)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(append(tiff, entry...), 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(append(out, app1...), payload...)
+	return append(out, data[2:]...)
+}
+
+func TestExifOrientation(t *testing.T) {
+	assert := assert.New(t)
+
+	img := gradient(300, 200)
+	data := withOrientation(t, img, 6)
+	assert.Equal(6, exifOrientation(data))
+	assert.Equal(1, exifOrientation([]byte("not a jpeg")))
+
+	analyzer := NewAnalyzer(Config{})
+	res, err := analyzer.AnalyzeReader(bytes.NewReader(data), 100, 100, Options{})
+	assert.NoError(err)
+	assert.Equal(6, res.Orientation)
+	assert.True(res.Crop.In(image.Rect(0, 0, 200, 300)), "crop %v outside display bounds", res.Crop)
+	assert.Equal(res.Crop.Dx(), res.RawCrop.Dy())
+	assert.Equal(res.Crop.Dy(), res.RawCrop.Dx())
+	assert.True(res.RawCrop.In(img.Bounds()), "raw crop %v outside stored bounds", res.RawCrop)
+}
+
+func TestStoredRect(t *testing.T) {
+	assert := assert.New(t)
+
+	stored := image.Rect(0, 0, 40, 20)
+	// the top left 10x5 of the displayed image for every orientation
+	display := image.Rect(0, 0, 10, 5)
+	assert.Equal(image.Rect(0, 0, 10, 5), storedRect(display, 1, stored))
+	assert.Equal(image.Rect(30, 0, 40, 5), storedRect(display, 2, stored))
+	assert.Equal(image.Rect(30, 15, 40, 20), storedRect(display, 3, stored))
+	assert.Equal(image.Rect(0, 15, 10, 20), storedRect(display, 4, stored))
+	assert.Equal(image.Rect(0, 0, 5, 10), storedRect(display, 5, stored))
+	assert.Equal(image.Rect(0, 10, 5, 20), storedRect(display, 6, stored))
+	assert.Equal(image.Rect(35, 10, 40, 20), storedRect(display, 7, stored))
+	assert.Equal(image.Rect(35, 0, 40, 10), storedRect(display, 8, stored))
+}
+
+func TestOrient(t *testing.T) {
+	assert := assert.New(t)
+
+	stored := gradient(40, 20)
+	for o := 2; o <= 8; o++ {
+		view := orient(stored, o)
+		rotated := orientRGBA(stored, o)
+		assert.Equal(rotated.Bounds(), view.Bounds(), "orientation %d", o)
+		for _, p := range []image.Point{{0, 0}, {3, 7}, {rotated.Bounds().Dx() - 1, rotated.Bounds().Dy() - 1}} {
+			assert.Equal(rotated.At(p.X, p.Y), view.At(p.X, p.Y), "orientation %d at %v", o, p)
+		}
+
+		// the analysis sees the same pixels as with the full resolution copy
+		lowimg, _, _ := NewAnalyzer(Config{}).(*analyzer).prescale(view)
+		assert.Equal(rotated.Pix, lowimg.Pix, "orientation %d", o)
+	}
+	assert.Equal(image.Image(stored), orient(stored, 1))
+}
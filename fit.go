@@ -0,0 +1,155 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// FitMode selects how the padding around a contained image gets filled
+type FitMode int
+
+const (
+	// FitSolid fills the padding with a solid color
+	FitSolid FitMode = iota
+	// FitBlur fills the padding with a blurred copy of the image scaled to cover the canvas
+	FitBlur
+	// FitExtend fills the padding by mirroring the image at its edges
+	FitExtend
+)
+
+// Layout describes how to produce an output of the requested size from a source image,
+// either by cropping or, when cropping would cut must-include content, by scaling the whole
+// image into a padded canvas
+type Layout struct {
+	// Crop is the best crop in source image coordinates, it fills the canvas when
+	// Padded is false
+	Crop image.Rectangle
+	// Padded is true when the whole source image is contained in the canvas
+	Padded bool
+	// Canvas is the output area in output pixels
+	Canvas image.Rectangle
+	// Placement is where the source (or the crop when not padded) is drawn on the canvas
+	Placement image.Rectangle
+}
+
+// Fit chooses between cropping and containing img in a width x height canvas. The best crop
+// is kept if it contains all of mustInclude, otherwise it is widened around them, and only
+// when no crop of the requested aspect ratio can hold them the image gets contained. Without
+// mustInclude the best crop is always used.
+func (a analyzer) Fit(img image.Image, width, height int, mustInclude []image.Rectangle) (Layout, error) {
+	if width <= 0 || height <= 0 {
+		return Layout{}, ErrInvalidDimensions
+	}
+
+	res, err := a.Analyze(img, width, height, Options{Faces: mustInclude})
+	if err != nil {
+		return Layout{}, err
+	}
+
+	var need image.Rectangle
+	for _, r := range mustInclude {
+		need = need.Union(r.Intersect(img.Bounds()))
+	}
+
+	canvas := image.Rect(0, 0, width, height)
+	layout := Layout{Crop: res.Crop, Canvas: canvas, Placement: canvas}
+	if need.In(res.Crop) {
+		return layout, nil
+	}
+	if frame, ok := frameSubject(need, img.Bounds(), width, height, 0); ok {
+		if a.debug {
+			a.logger.Infof("crop %v cuts must-include content, widened to %v", res.Crop, frame)
+		}
+		layout.Crop = frame
+		return layout, nil
+	}
+
+	layout = containLayout(img.Bounds(), width, height)
+	if a.debug {
+		a.logger.Infof("crop %v cuts must-include content, containing in %v at %v", res.Crop, canvas, layout.Placement)
+	}
+
+	return layout, nil
+}
+
+// containLayout returns the layout scaling an image with bounds b into the center of a
+// width x height canvas
+func containLayout(b image.Rectangle, width, height int) Layout {
+	scale := math.Min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	pw, ph := int(math.Round(float64(b.Dx())*scale)), int(math.Round(float64(b.Dy())*scale))
+	x, y := (width-pw)/2, (height-ph)/2
+	return Layout{
+		Crop:      b,
+		Padded:    true,
+		Canvas:    image.Rect(0, 0, width, height),
+		Placement: image.Rect(x, y, x+pw, y+ph),
+	}
+}
+
+// Render draws img according to the layout, filling padding as selected by mode. fill is
+// only used by FitSolid.
+func (l Layout) Render(img image.Image, resizer Resizer, mode FitMode, fill color.Color) *image.RGBA {
+	out := image.NewRGBA(l.Canvas)
+
+	if !l.Padded {
+		scaled := resizer.Resize(subImage(img, l.Crop), uint(l.Placement.Dx()), uint(l.Placement.Dy()))
+		draw.Copy(out, l.Placement.Min, scaled, scaled.Bounds(), draw.Src, nil)
+		return out
+	}
+
+	scaled := toRGBA(resizer.Resize(img, uint(l.Placement.Dx()), uint(l.Placement.Dy())))
+
+	switch mode {
+	case FitBlur:
+		b := img.Bounds()
+		scale := math.Max(float64(l.Canvas.Dx())/float64(b.Dx()), float64(l.Canvas.Dy())/float64(b.Dy()))
+		small := resizer.Resize(img, uint(math.Max(1, float64(b.Dx())*scale/fitBlurDownSample)), 0)
+		cover := resizer.Resize(small, uint(math.Ceil(float64(b.Dx())*scale)), uint(math.Ceil(float64(b.Dy())*scale)))
+		offset := image.Pt((cover.Bounds().Dx()-l.Canvas.Dx())/2, (cover.Bounds().Dy()-l.Canvas.Dy())/2)
+		draw.Copy(out, l.Canvas.Min, cover, image.Rectangle{Min: cover.Bounds().Min.Add(offset), Max: cover.Bounds().Max}, draw.Src, nil)
+	case FitExtend:
+		pw, ph := scaled.Bounds().Dx(), scaled.Bounds().Dy()
+		for y := l.Canvas.Min.Y; y < l.Canvas.Max.Y; y++ {
+			for x := l.Canvas.Min.X; x < l.Canvas.Max.X; x++ {
+				sx := reflect(x-l.Placement.Min.X, pw)
+				sy := reflect(y-l.Placement.Min.Y, ph)
+				out.SetRGBA(x, y, scaled.RGBAAt(scaled.Bounds().Min.X+sx, scaled.Bounds().Min.Y+sy))
+			}
+		}
+	default:
+		draw.Draw(out, l.Canvas, image.NewUniform(fill), image.Point{}, draw.Src)
+	}
+
+	draw.Copy(out, l.Placement.Min, scaled, scaled.Bounds(), draw.Src, nil)
+	return out
+}
+
+// reflect mirrors v into [0, n)
+func reflect(v, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	v %= 2 * n
+	if v < 0 {
+		v += 2 * n
+	}
+	if v >= n {
+		v = 2*n - 1 - v
+	}
+	return v
+}
+
+// subImage returns the part of img inside r, copying only if img cannot share its pixels
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	out := image.NewRGBA(r)
+	draw.Copy(out, r.Min, img, r, draw.Src, nil)
+	return out
+}
@@ -0,0 +1,88 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFit(t *testing.T) {
+	assert := assert.New(t)
+	analyzer := NewAnalyzer(Config{})
+	img := gradient(600, 400)
+
+	cases := []struct {
+		width, height int
+		mustInclude   []image.Rectangle
+	}{
+		{100, 100, []image.Rectangle{image.Rect(400, 250, 480, 330)}},
+		{320, 180, []image.Rectangle{image.Rect(100, 100, 140, 140), image.Rect(300, 150, 340, 190)}},
+		{200, 300, []image.Rectangle{image.Rect(10, 10, 40, 40), image.Rect(200, 350, 230, 380)}},
+	}
+	for _, c := range cases {
+		layout, err := analyzer.Fit(img, c.width, c.height, c.mustInclude)
+		assert.NoError(err)
+		assert.False(layout.Padded, "%v", c.mustInclude)
+		assert.Equal(image.Rect(0, 0, c.width, c.height), layout.Canvas)
+		assert.True(layout.Crop.In(img.Bounds()), "crop %v outside the image", layout.Crop)
+		for _, r := range c.mustInclude {
+			assert.True(r.In(layout.Crop), "crop %v cuts %v", layout.Crop, r)
+		}
+		assert.InDelta(float64(c.width)/float64(c.height), float64(layout.Crop.Dx())/float64(layout.Crop.Dy()), 0.02)
+	}
+
+	// rects spread wider than any square crop of the image get letterboxed
+	layout, err := analyzer.Fit(img, 300, 300, []image.Rectangle{image.Rect(20, 20, 60, 60), image.Rect(500, 300, 560, 360)})
+	assert.NoError(err)
+	assert.True(layout.Padded)
+	assert.Equal(img.Bounds(), layout.Crop)
+	assert.Equal(image.Rect(0, 50, 300, 250), layout.Placement)
+
+	// a framed photo without must-include content gets cropped
+	framed := letterboxed(800, 400, image.Rect(10, 10, 790, 390))
+	layout, err = analyzer.Fit(framed, 100, 100, nil)
+	assert.NoError(err)
+	assert.False(layout.Padded)
+	assert.Equal(layout.Crop.Dx(), layout.Crop.Dy())
+
+	_, err = analyzer.Fit(img, 0, 100, nil)
+	assert.Equal(ErrInvalidDimensions, err)
+}
+
+func TestLayoutRender(t *testing.T) {
+	assert := assert.New(t)
+	resizer := NewDefaultResizer()
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	layout := containLayout(img.Bounds(), 100, 100)
+	assert.Equal(image.Rect(0, 25, 100, 75), layout.Placement)
+
+	out := layout.Render(img, resizer, FitSolid, blue)
+	assert.Equal(image.Rect(0, 0, 100, 100), out.Bounds())
+	assert.Equal(blue, out.RGBAAt(50, 5))
+	assert.Equal(blue, out.RGBAAt(50, 95))
+	assert.Equal(red, out.RGBAAt(50, 50))
+
+	out = layout.Render(img, resizer, FitExtend, blue)
+	assert.Equal(red, out.RGBAAt(50, 5))
+	assert.Equal(red, out.RGBAAt(50, 95))
+
+	out = layout.Render(img, resizer, FitBlur, blue)
+	for _, p := range []image.Point{{50, 5}, {50, 95}, {50, 50}} {
+		c := out.RGBAAt(p.X, p.Y)
+		assert.True(c.R > 200 && c.B < 50 && c.A == 255, "%v is %v", p, c)
+	}
+
+	// crops fill the whole canvas
+	crop := Layout{Crop: image.Rect(50, 0, 150, 100), Canvas: image.Rect(0, 0, 40, 40), Placement: image.Rect(0, 0, 40, 40)}
+	out = crop.Render(img, resizer, FitSolid, blue)
+	assert.Equal(image.Rect(0, 0, 40, 40), out.Bounds())
+	assert.Equal(red, out.RGBAAt(0, 0))
+	assert.Equal(red, out.RGBAAt(39, 39))
+}
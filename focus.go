@@ -0,0 +1,63 @@
+package cropper
+
+import (
+	"image"
+	"math"
+)
+
+// focusDetect measures local sharpness as the variance of the Laplacian of the luminance
+// over focusWindow sized windows. Windows are scaled against the sharpest one so in focus
+// regions come out bright while blurred regions stay dark, even if they contain a lot of
+// low contrast detail. Images without any sharp window return an empty map.
+func focusDetect(cies []float64, width, height int) *image.Gray {
+	o := image.NewGray(image.Rect(0, 0, width, height))
+
+	cols := (width + focusWindow - 1) / focusWindow
+	rows := (height + focusWindow - 1) / focusWindow
+	variances := make([]float64, cols*rows)
+	maxVariance := 0.0
+
+	for wy := 0; wy < rows; wy++ {
+		for wx := 0; wx < cols; wx++ {
+			var sum, sumSq, n float64
+			for y := wy * focusWindow; y < (wy+1)*focusWindow && y < height-1; y++ {
+				if y == 0 {
+					continue
+				}
+				for x := wx * focusWindow; x < (wx+1)*focusWindow && x < width-1; x++ {
+					if x == 0 {
+						continue
+					}
+					lap := cies[y*width+x]*4.0 -
+						cies[x+(y-1)*width] -
+						cies[x-1+y*width] -
+						cies[x+1+y*width] -
+						cies[x+(y+1)*width]
+					sum += lap
+					sumSq += lap * lap
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			mean := sum / n
+			v := sumSq/n - mean*mean
+			variances[wy*cols+wx] = v
+			maxVariance = math.Max(maxVariance, v)
+		}
+	}
+
+	if maxVariance < focusMinVariance {
+		return o
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := variances[(y/focusWindow)*cols+x/focusWindow] / maxVariance
+			o.Pix[y*o.Stride+x] = uint8(bounds(v * 255.0))
+		}
+	}
+
+	return o
+}
@@ -0,0 +1,35 @@
+package cropper
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFocusDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	// a sharp checkerboard on the left, a smooth ramp of the same range on the right
+	width, height := 128, 64
+	cies := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				cies[y*width+x] = float64((x+y)%2) * 200
+			} else {
+				cies[y*width+x] = float64(x-width/2) * 200 / float64(width/2)
+			}
+		}
+	}
+
+	o := focusDetect(cies, width, height)
+	assert.Equal(uint8(255), o.GrayAt(24, 24).Y)
+	assert.True(o.GrayAt(100, 24).Y < 10, "blurred region scored %d", o.GrayAt(100, 24).Y)
+
+	// a flat image has nothing in focus
+	flat := make([]float64, width*height)
+	o = focusDetect(flat, width, height)
+	for _, v := range o.Pix {
+		assert.Equal(uint8(0), v)
+	}
+}
@@ -0,0 +1,251 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// GIFOptions control how CropGIF analyzes and re-encodes an animation
+type GIFOptions struct {
+	// Frames is the maximum number of frames sampled for the analysis, zero means
+	// gifSampleFrames. Samples are spread evenly over the animation.
+	Frames int
+	// Resize scales the cropped animation to exactly width x height
+	Resize bool
+}
+
+// CropGIF picks one crop for all frames of g by aggregating the detector output of sampled
+// frames, and returns the cropped animation along with the crop. Frames keep their palette,
+// delay and disposal, resizing uses nearest neighbor sampling so palette indices and
+// transparency are preserved. Frames outside the crop are reduced to a single pixel that
+// leaves the output unchanged.
+func (a analyzer) CropGIF(g *gif.GIF, width, height int, opts GIFOptions) (*gif.GIF, image.Rectangle, error) {
+	if width == 0 && height == 0 {
+		return nil, image.Rectangle{}, ErrInvalidDimensions
+	}
+	if len(g.Image) == 0 {
+		return nil, image.Rectangle{}, ErrInvalidDimensions
+	}
+
+	canvas := gifBounds(g)
+	samples := opts.Frames
+	if samples <= 0 {
+		samples = gifSampleFrames
+	}
+	sampled := make(map[int]bool)
+	for i := 0; i < samples && i < len(g.Image); i++ {
+		sampled[i*len(g.Image)/int(math.Min(float64(samples), float64(len(g.Image))))] = true
+	}
+
+	var maps []*features
+	var prescalefactor float64
+	var content image.Rectangle
+	composeGIF(g, canvas, func(i int, frame *image.RGBA) {
+		if !sampled[i] {
+			return
+		}
+		lowimg, cies, f := a.prescale(frame)
+		prescalefactor, content = f, lowimg.Bounds()
+		maps = append(maps, a.detect(lowimg, cies))
+	})
+	if a.debug {
+		a.logger.Infof("analyzed %d of %d frames", len(maps), len(g.Image))
+	}
+
+	s := a.newSearch(width, height, float64(canvas.Dx()), float64(canvas.Dy()), prescalefactor, content, Options{})
+	topCrop, err := a.bestCrop(averageFeatures(maps), s)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	crop := scaleRect(topCrop.Rectangle, prescalefactor).Add(canvas.Min).Intersect(canvas)
+
+	outWidth, outHeight := crop.Dx(), crop.Dy()
+	if opts.Resize && width > 0 && height > 0 {
+		outWidth, outHeight = width, height
+	}
+
+	out := &gif.GIF{
+		Image:           make([]*image.Paletted, len(g.Image)),
+		Delay:           append([]int{}, g.Delay...),
+		Disposal:        append([]byte{}, g.Disposal...),
+		LoopCount:       g.LoopCount,
+		BackgroundIndex: g.BackgroundIndex,
+		Config:          image.Config{ColorModel: g.Config.ColorModel, Width: outWidth, Height: outHeight},
+	}
+	opaque := make(map[int]bool)
+	for i, frame := range g.Image {
+		f, empty := cropFrame(frame, crop, outWidth, outHeight)
+		out.Image[i] = f
+		if !empty {
+			continue
+		}
+		// disposing the placeholder would clear a pixel the frame never drew
+		if i < len(out.Disposal) {
+			out.Disposal[i] = gif.DisposalNone
+		}
+		if _, _, _, a := f.At(0, 0).RGBA(); a != 0 {
+			opaque[i] = true
+		}
+	}
+	if len(opaque) > 0 {
+		// without a transparent palette entry repeat what the animation shows at the pixel
+		composeGIF(g, canvas, func(i int, screen *image.RGBA) {
+			if opaque[i] {
+				f := out.Image[i]
+				f.SetColorIndex(0, 0, uint8(f.Palette.Index(screen.At(crop.Min.X, crop.Min.Y))))
+			}
+		})
+	}
+
+	return out, crop, nil
+}
+
+// gifBounds returns the logical screen of g, falling back to the union of the frames
+func gifBounds(g *gif.GIF) image.Rectangle {
+	if g.Config.Width > 0 && g.Config.Height > 0 {
+		return image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	}
+	var r image.Rectangle
+	for _, frame := range g.Image {
+		r = r.Union(frame.Bounds())
+	}
+	return r
+}
+
+// composeGIF renders every frame of g onto the canvas honoring disposal methods and calls
+// fn with the fully composed frame, which is only valid during the call
+func composeGIF(g *gif.GIF, canvas image.Rectangle, fn func(i int, frame *image.RGBA)) {
+	screen := image.NewRGBA(canvas)
+	var previous *image.RGBA
+	for i, frame := range g.Image {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas)
+			copy(previous.Pix, screen.Pix)
+		}
+
+		draw.Draw(screen, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		fn(i, screen)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(screen, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(screen.Pix, previous.Pix)
+		}
+	}
+}
+
+// averageFeatures combines the detector output of several frames into one
+func averageFeatures(maps []*features) *features {
+	avg := &features{RGBA: image.NewRGBA(maps[0].Bounds())}
+	if maps[0].focus != nil {
+		avg.focus = image.NewGray(maps[0].focus.Bounds())
+	}
+	if maps[0].saliency != nil {
+		avg.saliency = image.NewGray(maps[0].saliency.Bounds())
+	}
+
+	n := float64(len(maps))
+	for i := range avg.Pix {
+		sum := 0.0
+		for _, m := range maps {
+			sum += float64(m.Pix[i])
+		}
+		avg.Pix[i] = uint8(sum / n)
+	}
+	if avg.focus != nil {
+		for i := range avg.focus.Pix {
+			sum := 0.0
+			for _, m := range maps {
+				sum += float64(m.focus.Pix[i])
+			}
+			avg.focus.Pix[i] = uint8(sum / n)
+		}
+	}
+	if avg.saliency != nil {
+		for i := range avg.saliency.Pix {
+			sum := 0.0
+			for _, m := range maps {
+				sum += float64(m.saliency.Pix[i])
+			}
+			avg.saliency.Pix[i] = uint8(sum / n)
+		}
+	}
+
+	return avg
+}
+
+// cropFrame returns the part of frame inside crop, moved to the origin and scaled from the
+// crop size to width x height by nearest neighbor sampling. empty is true when frame lies
+// outside the crop and got replaced by emptyFrame.
+func cropFrame(frame *image.Paletted, crop image.Rectangle, width, height int) (out *image.Paletted, empty bool) {
+	sx := float64(width) / float64(crop.Dx())
+	sy := float64(height) / float64(crop.Dy())
+
+	src := frame.Bounds().Intersect(crop)
+	if src.Empty() {
+		// keep the frame (and its delay) but let it draw a single transparent pixel
+		return emptyFrame(frame), true
+	}
+	src = src.Sub(crop.Min)
+
+	dst := image.Rect(
+		int(math.Floor(float64(src.Min.X)*sx)),
+		int(math.Floor(float64(src.Min.Y)*sy)),
+		int(math.Ceil(float64(src.Max.X)*sx)),
+		int(math.Ceil(float64(src.Max.Y)*sy)),
+	).Intersect(image.Rect(0, 0, width, height))
+	if dst.Empty() {
+		return emptyFrame(frame), true
+	}
+
+	out = image.NewPaletted(dst, frame.Palette)
+	for y := dst.Min.Y; y < dst.Max.Y; y++ {
+		fy := clamp(int((float64(y)+0.5)/sy), src.Min.Y, src.Max.Y-1) + crop.Min.Y
+		for x := dst.Min.X; x < dst.Max.X; x++ {
+			fx := clamp(int((float64(x)+0.5)/sx), src.Min.X, src.Max.X-1) + crop.Min.X
+			out.SetColorIndex(x, y, frame.ColorIndexAt(fx, fy))
+		}
+	}
+	return out, false
+}
+
+// emptyFrame returns a 1x1 transparent frame using the palette of frame, the pixel is left at
+// index 0 when a full palette has no transparent entry
+func emptyFrame(frame *image.Paletted) *image.Paletted {
+	p := frame.Palette
+	idx := -1
+	for i, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 && len(p) < 256 {
+		p = append(append(color.Palette{}, p...), color.Transparent)
+		idx = len(p) - 1
+	}
+	out := image.NewPaletted(image.Rect(0, 0, 1, 1), p)
+	if idx >= 0 {
+		out.SetColorIndex(0, 0, uint8(idx))
+	}
+	return out
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
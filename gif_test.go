@@ -0,0 +1,127 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var gifPalette = color.Palette{
+	color.Transparent,
+	color.RGBA{128, 128, 128, 255},
+	color.RGBA{230, 20, 20, 255},
+	color.RGBA{250, 240, 30, 255},
+}
+
+// gifFrame returns a frame covering r filled with the palette index i, or with a red and
+// yellow checkerboard when i is negative
+func gifFrame(r image.Rectangle, i int) *image.Paletted {
+	frame := image.NewPaletted(r, gifPalette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			idx := uint8(i)
+			if i < 0 {
+				idx = uint8(2 + (x/4+y/4)%2)
+			}
+			frame.SetColorIndex(x, y, idx)
+		}
+	}
+	return frame
+}
+
+func TestComposeGIFDisposal(t *testing.T) {
+	assert := assert.New(t)
+
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			gifFrame(image.Rect(0, 0, 100, 100), 1),
+			gifFrame(image.Rect(0, 0, 10, 10), 2),
+			gifFrame(image.Rect(50, 50, 51, 51), 3),
+			gifFrame(image.Rect(60, 60, 61, 61), 2),
+		},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{Width: 100, Height: 100},
+	}
+	var at5, at50 []color.RGBA
+	composeGIF(g, gifBounds(g), func(i int, frame *image.RGBA) {
+		at5 = append(at5, frame.RGBAAt(5, 5))
+		at50 = append(at50, frame.RGBAAt(50, 50))
+	})
+
+	gray, red, yellow := gifPalette[1].(color.RGBA), gifPalette[2].(color.RGBA), gifPalette[3].(color.RGBA)
+	// frame 1 gets cleared to the background, frame 2 restores the screen before it
+	assert.Equal([]color.RGBA{gray, red, {}, {}}, at5)
+	assert.Equal([]color.RGBA{gray, gray, yellow, gray}, at50)
+}
+
+func TestCropGIF(t *testing.T) {
+	assert := assert.New(t)
+
+	patch := image.Rect(80, 20, 112, 60)
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			gifFrame(image.Rect(0, 0, 120, 80), 1),
+			gifFrame(patch, -1),
+			gifFrame(image.Rect(0, 0, 8, 8), 2),
+		},
+		Delay:     []int{10, 20, 30},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalBackground},
+		LoopCount: 3,
+		Config:    image.Config{ColorModel: gifPalette, Width: 120, Height: 80},
+	}
+	analyzer := NewAnalyzer(Config{})
+
+	out, crop, err := analyzer.CropGIF(g, 40, 40, GIFOptions{})
+	assert.NoError(err)
+	assert.Equal(crop.Dx(), crop.Dy())
+	assert.True(crop.Dx() >= 72, "crop %v is below minScale", crop)
+	assert.True(patch.In(crop), "crop %v cuts %v", crop, patch)
+	assert.Equal(g.Delay, out.Delay)
+	// the emptied frame must not clear the pixel it is reduced to
+	assert.Equal([]byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone}, out.Disposal)
+	assert.Equal(g.LoopCount, out.LoopCount)
+	assert.Equal(image.Config{ColorModel: gifPalette, Width: crop.Dx(), Height: crop.Dy()}, out.Config)
+	assert.Len(out.Image, 3)
+	for i, frame := range out.Image {
+		assert.True(frame.Bounds().In(image.Rect(0, 0, crop.Dx(), crop.Dy())), "frame %d at %v", i, frame.Bounds())
+	}
+	assert.Equal(patch.Sub(crop.Min), out.Image[1].Bounds())
+	// the frame left of the crop is kept as a single transparent pixel
+	assert.Equal(image.Rect(0, 0, 1, 1), out.Image[2].Bounds())
+	_, _, _, a := out.Image[2].At(0, 0).RGBA()
+	assert.Equal(uint32(0), a)
+
+	out, crop, err = analyzer.CropGIF(g, 40, 40, GIFOptions{Resize: true, Frames: 2})
+	assert.NoError(err)
+	assert.Equal(40, out.Config.Width)
+	assert.Equal(40, out.Config.Height)
+	assert.Equal(image.Rect(0, 0, 40, 40), out.Image[0].Bounds())
+	scale := 40 / float64(crop.Dx())
+	r := patch.Sub(crop.Min)
+	b := out.Image[1].Bounds()
+	assert.InDelta(float64(r.Min.X)*scale, b.Min.X, 1)
+	assert.InDelta(float64(r.Min.Y)*scale, b.Min.Y, 1)
+	assert.InDelta(float64(r.Max.X)*scale, b.Max.X, 1)
+	assert.InDelta(float64(r.Max.Y)*scale, b.Max.Y, 1)
+
+	// with a full palette and no transparent entry the pixel repeats the animation
+	full := make(color.Palette, 256)
+	for i := range full {
+		full[i] = color.RGBA{0, 0, uint8(i), 255}
+	}
+	copy(full[1:], gifPalette[1:])
+	for _, frame := range g.Image {
+		frame.Palette = full
+	}
+	out, _, err = analyzer.CropGIF(g, 40, 40, GIFOptions{})
+	assert.NoError(err)
+	assert.Equal(image.Rect(0, 0, 1, 1), out.Image[2].Bounds())
+	assert.Equal(gifPalette[1], out.Image[2].At(0, 0))
+	assert.Equal(byte(gif.DisposalNone), out.Disposal[2])
+
+	_, _, err = analyzer.CropGIF(&gif.GIF{}, 40, 40, GIFOptions{})
+	assert.Equal(ErrInvalidDimensions, err)
+}
@@ -0,0 +1,211 @@
+package cropper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	iccHeader            = "ICC_PROFILE\x00"
+	exifIFDPointerTag    = 0x8769
+	gpsIFDPointerTag     = 0x8825
+	pixelXDimensionTag   = 0xA002
+	pixelYDimensionTag   = 0xA003
+	thumbnailOffsetTag   = 0x0201
+	thumbnailLengthTag   = 0x0202
+	maxJPEGSegmentLength = 0xFFFF - 2
+)
+
+// Metadata holds the EXIF and ICC profile segments of a JPEG file so they can be carried
+// over to an encoded crop, see EncoderOptions
+type Metadata struct {
+	// EXIF is the APP1 payload, starting with the "Exif\0\0" header
+	EXIF []byte
+	// ICC holds the APP2 ICC_PROFILE payloads in file order, large profiles are split
+	// over several segments
+	ICC [][]byte
+}
+
+// ReadMetadata returns the EXIF and ICC profile segments of the JPEG file in data, or nil if
+// it has neither
+func ReadMetadata(data []byte) *Metadata {
+	md := &Metadata{}
+	jpegSegments(data, func(marker byte, payload []byte) bool {
+		switch {
+		case marker == 0xE1 && md.EXIF == nil && bytes.HasPrefix(payload, []byte(exifHeader)):
+			md.EXIF = append([]byte{}, payload...)
+		case marker == 0xE2 && bytes.HasPrefix(payload, []byte(iccHeader)):
+			md.ICC = append(md.ICC, append([]byte{}, payload...))
+		}
+		return true
+	})
+	if md.EXIF == nil && md.ICC == nil {
+		return nil
+	}
+	return md
+}
+
+// writeJPEGWithMetadata writes the JPEG in encoded to w with the metadata segments inserted
+// right after the start of image marker. The EXIF orientation is reset since the pixels are
+// written as displayed, the EXIF dimensions are set to width x height and the thumbnail of
+// the source is dropped.
+func writeJPEGWithMetadata(w io.Writer, encoded []byte, md *Metadata, width, height int, stripGPS bool) error {
+	if len(encoded) < 2 {
+		_, err := w.Write(encoded)
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(encoded[:2])
+	if md.EXIF != nil {
+		exif, err := updateExif(md.EXIF, width, height, stripGPS)
+		if err != nil {
+			return err
+		}
+		writeJPEGSegment(&buf, 0xE1, exif)
+	}
+	for _, icc := range md.ICC {
+		writeJPEGSegment(&buf, 0xE2, icc)
+	}
+	buf.Write(encoded[2:])
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeJPEGSegment(buf *bytes.Buffer, marker byte, payload []byte) {
+	if len(payload) > maxJPEGSegmentLength {
+		return
+	}
+	var header [4]byte
+	header[0], header[1] = 0xFF, marker
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	buf.Write(header[:])
+	buf.Write(payload)
+}
+
+// updateExif returns a copy of the EXIF payload with the orientation reset to 1, the pixel
+// dimensions updated, IFD1 and the thumbnail it describes dropped and, when stripGPS is set,
+// the GPS IFD erased and unlinked. It returns ErrInvalidMetadata when payload does not hold
+// a TIFF structure behind the EXIF header.
+func updateExif(payload []byte, width, height int, stripGPS bool) ([]byte, error) {
+	if !bytes.HasPrefix(payload, []byte(exifHeader)) {
+		return nil, ErrInvalidMetadata
+	}
+	out := append([]byte{}, payload...)
+	tiff := out[len(exifHeader):]
+	order, ifd0, ok := tiffHeader(tiff)
+	if !ok || ifd0 < 8 || ifd0+2 > len(tiff) {
+		return nil, ErrInvalidMetadata
+	}
+
+	if e, ok := ifdEntry(tiff, order, ifd0, exifOrientationTag); ok {
+		order.PutUint16(tiff[e+8:], 1)
+	}
+
+	if e, ok := ifdEntry(tiff, order, ifd0, exifIFDPointerTag); ok {
+		exifIFD := int(order.Uint32(tiff[e+8:]))
+		setDimension(tiff, order, exifIFD, pixelXDimensionTag, width)
+		setDimension(tiff, order, exifIFD, pixelYDimensionTag, height)
+	}
+
+	if stripGPS {
+		if e, ok := ifdEntry(tiff, order, ifd0, gpsIFDPointerTag); ok {
+			zeroIFD(tiff, order, int(order.Uint32(tiff[e+8:])))
+			removeEntry(tiff, order, ifd0, e)
+		}
+	}
+
+	// the thumbnail shows the uncropped image, so IFD1 gets erased and unlinked
+	if next := ifd0 + 2 + int(order.Uint16(tiff[ifd0:]))*12; next+4 <= len(tiff) {
+		if ifd1 := int(order.Uint32(tiff[next:])); ifd1 > 0 {
+			zeroThumbnail(tiff, order, ifd1)
+			zeroIFD(tiff, order, ifd1)
+			order.PutUint32(tiff[next:], 0)
+		}
+	}
+
+	return out, nil
+}
+
+// zeroThumbnail clears the JPEG thumbnail referenced by the IFD at offset ifd
+func zeroThumbnail(tiff []byte, order binary.ByteOrder, ifd int) {
+	o, ok := ifdEntry(tiff, order, ifd, thumbnailOffsetTag)
+	if !ok {
+		return
+	}
+	l, ok := ifdEntry(tiff, order, ifd, thumbnailLengthTag)
+	if !ok {
+		return
+	}
+	off, size := int(order.Uint32(tiff[o+8:])), int(order.Uint32(tiff[l+8:]))
+	if off > 0 && size > 0 && off+size <= len(tiff) {
+		zero(tiff[off : off+size])
+	}
+}
+
+// setDimension writes v to a SHORT or LONG tag of the IFD at offset ifd
+func setDimension(tiff []byte, order binary.ByteOrder, ifd int, tag uint16, v int) {
+	e, ok := ifdEntry(tiff, order, ifd, tag)
+	if !ok {
+		return
+	}
+	switch order.Uint16(tiff[e+2:]) {
+	case 3:
+		order.PutUint16(tiff[e+8:], uint16(v))
+	case 4:
+		order.PutUint32(tiff[e+8:], uint32(v))
+	}
+}
+
+// zeroIFD clears all entries of the IFD at offset ifd along with the values they point to
+func zeroIFD(tiff []byte, order binary.ByteOrder, ifd int) {
+	if ifd <= 0 || ifd+2 > len(tiff) {
+		return
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		e := ifd + 2 + i*12
+		if e+12 > len(tiff) {
+			break
+		}
+		size := tiffTypeSize(order.Uint16(tiff[e+2:])) * int(order.Uint32(tiff[e+4:]))
+		if off := int(order.Uint32(tiff[e+8:])); size > 4 && off > 0 && off+size <= len(tiff) {
+			zero(tiff[off : off+size])
+		}
+		zero(tiff[e : e+12])
+	}
+	order.PutUint16(tiff[ifd:], 0)
+}
+
+// removeEntry deletes the entry at offset e from the IFD at offset ifd, moving the following
+// entries and the next IFD offset up
+func removeEntry(tiff []byte, order binary.ByteOrder, ifd, e int) {
+	count := int(order.Uint16(tiff[ifd:]))
+	end := ifd + 2 + count*12 + 4
+	if end > len(tiff) {
+		return
+	}
+	copy(tiff[e:end-12], tiff[e+12:end])
+	zero(tiff[end-12 : end])
+	order.PutUint16(tiff[ifd:], uint16(count-1))
+}
+
+func tiffTypeSize(t uint16) int {
+	switch t {
+	case 3, 8:
+		return 2
+	case 4, 9, 11:
+		return 4
+	case 5, 10, 12:
+		return 8
+	}
+	return 1
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
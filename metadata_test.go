@@ -0,0 +1,129 @@
+package cropper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// buildTIFF writes IFD0, an Exif IFD, a GPS IFD with one out of line value and IFD1 with a
+// thumbnail
+func buildTIFF() []byte {
+	order := binary.LittleEndian
+	var buf bytes.Buffer
+	buf.WriteString("II\x2a\x00")
+	binary.Write(&buf, order, uint32(8))
+
+	writeIFD := func(entries []tiffEntry, next uint32) {
+		binary.Write(&buf, order, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(&buf, order, e.tag)
+			binary.Write(&buf, order, e.typ)
+			binary.Write(&buf, order, e.count)
+			binary.Write(&buf, order, e.value)
+		}
+		binary.Write(&buf, order, next)
+	}
+
+	// IFD0 at 8 with 3 entries takes 2+36+4 bytes, the Exif IFD follows at 50
+	writeIFD([]tiffEntry{
+		{exifOrientationTag, 3, 1, 6},
+		{exifIFDPointerTag, 4, 1, 50},
+		{gpsIFDPointerTag, 4, 1, 80},
+	}, 122)
+	// Exif IFD at 50 with 2 entries takes 2+24+4 bytes, the GPS IFD follows at 80
+	writeIFD([]tiffEntry{
+		{pixelXDimensionTag, 4, 1, 4000},
+		{pixelYDimensionTag, 3, 1, 3000},
+	}, 0)
+	// GPS IFD at 80 with 1 entry takes 2+12+4 bytes, its latitude follows at 98
+	writeIFD([]tiffEntry{{2, 5, 3, 98}}, 0)
+	for i := 0; i < 24; i++ {
+		buf.WriteByte(0x42)
+	}
+	// IFD1 at 122 with 2 entries takes 2+24+4 bytes, the thumbnail follows at 152
+	writeIFD([]tiffEntry{
+		{thumbnailOffsetTag, 4, 1, 152},
+		{thumbnailLengthTag, 4, 1, 16},
+	}, 0)
+	for i := 0; i < 16; i++ {
+		buf.WriteByte(0x37)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	var src bytes.Buffer
+	assert.NoError(jpeg.Encode(&src, gradient(64, 48), nil))
+	icc := append([]byte(iccHeader), 1, 1, 'p', 'r', 'o', 'f', 'i', 'l', 'e')
+	var withMeta bytes.Buffer
+	withMeta.Write(src.Bytes()[:2])
+	writeJPEGSegment(&withMeta, 0xE1, append([]byte(exifHeader), buildTIFF()...))
+	writeJPEGSegment(&withMeta, 0xE2, icc)
+	withMeta.Write(src.Bytes()[2:])
+
+	md := ReadMetadata(withMeta.Bytes())
+	if !assert.NotNil(md) {
+		return
+	}
+	assert.Equal([][]byte{icc}, md.ICC)
+
+	enc, err := NewEncoder(EncoderOptions{Format: "jpeg", Metadata: md, StripGPS: true})
+	assert.NoError(err)
+	var out bytes.Buffer
+	assert.NoError(enc.Encode(&out, image.NewRGBA(image.Rect(0, 0, 32, 24))))
+
+	written := ReadMetadata(out.Bytes())
+	if !assert.NotNil(written) {
+		return
+	}
+	assert.Equal([][]byte{icc}, written.ICC)
+	assert.Equal(1, exifOrientation(out.Bytes()))
+
+	tiff := written.EXIF[len(exifHeader):]
+	order, ifd0, ok := tiffHeader(tiff)
+	assert.True(ok)
+	_, hasGPS := ifdEntry(tiff, order, ifd0, gpsIFDPointerTag)
+	assert.False(hasGPS)
+	assert.NotContains(string(tiff), "\x42\x42\x42")
+	next := ifd0 + 2 + int(order.Uint16(tiff[ifd0:]))*12
+	assert.Equal(uint32(0), order.Uint32(tiff[next:]), "IFD1 is still linked")
+	_, hasThumbnail := ifdEntry(tiff, order, 122, thumbnailOffsetTag)
+	assert.False(hasThumbnail)
+	assert.NotContains(string(tiff), "\x37\x37\x37")
+
+	e, ok := ifdEntry(tiff, order, ifd0, exifIFDPointerTag)
+	assert.True(ok)
+	exifIFD := int(order.Uint32(tiff[e+8:]))
+	x, _ := ifdEntry(tiff, order, exifIFD, pixelXDimensionTag)
+	y, _ := ifdEntry(tiff, order, exifIFD, pixelYDimensionTag)
+	assert.Equal(uint32(32), order.Uint32(tiff[x+8:]))
+	assert.Equal(uint16(24), order.Uint16(tiff[y+8:]))
+
+	_, err = jpeg.Decode(&out)
+	assert.NoError(err)
+}
+
+func TestWriteInvalidMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for _, exif := range [][]byte{{}, []byte("Exif"), []byte("Exif\x00\x00II"), []byte("Exif\x00\x00II\x2a\x00\xff\xff\x00\x00")} {
+		enc, err := NewEncoder(EncoderOptions{Format: "jpeg", Metadata: &Metadata{EXIF: exif}})
+		assert.NoError(err)
+		assert.Equal(ErrInvalidMetadata, enc.Encode(ioutil.Discard, img), "%q", exif)
+	}
+}
@@ -0,0 +1,140 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// PaletteColor is a dominant color along with the fraction of pixels it represents
+type PaletteColor struct {
+	Color    color.RGBA
+	Coverage float64
+}
+
+// palette extracts up to k dominant colors from r of img using median cut, the boxes with
+// the widest channel range are split at their median until k boxes exist. Splits never
+// separate equal values and near identical colors get merged, so flat regions yield one color.
+func palette(img *image.RGBA, r image.Rectangle, k int) []PaletteColor {
+	r = r.Intersect(img.Bounds())
+	pixels := make([]color.RGBA, 0, r.Dx()*r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			pixels = append(pixels, img.RGBAAt(x, y))
+		}
+	}
+	if len(pixels) == 0 {
+		return nil
+	}
+
+	boxes := []colorBox{{pixels: pixels}}
+	for len(boxes) < k {
+		idx, channel, spread := -1, 0, 0
+		for i, b := range boxes {
+			if len(b.pixels) < 2 {
+				continue
+			}
+			if c, s := b.widestChannel(); s > spread {
+				idx, channel, spread = i, c, s
+			}
+		}
+		if idx < 0 {
+			break
+		}
+
+		b := boxes[idx]
+		sort.Slice(b.pixels, func(i, j int) bool {
+			return channelValue(b.pixels[i], channel) < channelValue(b.pixels[j], channel)
+		})
+		mid := splitIndex(b.pixels, channel)
+		boxes[idx] = colorBox{pixels: b.pixels[:mid]}
+		boxes = append(boxes, colorBox{pixels: b.pixels[mid:]})
+	}
+
+	res := make([]PaletteColor, 0, len(boxes))
+	counts := make([]int, 0, len(boxes))
+boxes:
+	for _, b := range boxes {
+		c := b.average()
+		for i := range res {
+			if colorDistance(res[i].Color, c) <= paletteMergeDistance {
+				n := counts[i] + len(b.pixels)
+				res[i].Color = color.RGBA{
+					uint8((int(res[i].Color.R)*counts[i] + int(c.R)*len(b.pixels)) / n),
+					uint8((int(res[i].Color.G)*counts[i] + int(c.G)*len(b.pixels)) / n),
+					uint8((int(res[i].Color.B)*counts[i] + int(c.B)*len(b.pixels)) / n),
+					255,
+				}
+				res[i].Coverage = float64(n) / float64(len(pixels))
+				counts[i] = n
+				continue boxes
+			}
+		}
+		res = append(res, PaletteColor{Color: c, Coverage: float64(len(b.pixels)) / float64(len(pixels))})
+		counts = append(counts, len(b.pixels))
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Coverage > res[j].Coverage
+	})
+
+	return res
+}
+
+// splitIndex returns the index closest to the median of pixels, sorted by channel, that
+// does not separate equal channel values
+func splitIndex(pixels []color.RGBA, channel int) int {
+	mid := len(pixels) / 2
+	v := channelValue(pixels[mid], channel)
+	lo := sort.Search(mid, func(i int) bool { return channelValue(pixels[i], channel) >= v })
+	hi := mid + sort.Search(len(pixels)-mid, func(i int) bool { return channelValue(pixels[mid+i], channel) > v })
+	if lo > 0 && (mid-lo <= hi-mid || hi == len(pixels)) {
+		return lo
+	}
+	return hi
+}
+
+type colorBox struct {
+	pixels []color.RGBA
+}
+
+// widestChannel returns the channel (0 red, 1 green, 2 blue) with the largest range
+func (b colorBox) widestChannel() (int, int) {
+	channel, spread := 0, -1
+	for c := 0; c < 3; c++ {
+		lo, hi := 255, 0
+		for _, p := range b.pixels {
+			v := channelValue(p, c)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > spread {
+			channel, spread = c, hi-lo
+		}
+	}
+	return channel, spread
+}
+
+func (b colorBox) average() color.RGBA {
+	var r, g, bl int
+	for _, p := range b.pixels {
+		r += int(p.R)
+		g += int(p.G)
+		bl += int(p.B)
+	}
+	n := len(b.pixels)
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+}
+
+func channelValue(c color.RGBA, channel int) int {
+	switch channel {
+	case 0:
+		return int(c.R)
+	case 1:
+		return int(c.G)
+	}
+	return int(c.B)
+}
@@ -0,0 +1,34 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPalette(t *testing.T) {
+	assert := assert.New(t)
+	red := color.RGBA{200, 30, 30, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(img, img.Bounds(), image.NewUniform(red), image.Point{}, draw.Src)
+	assert.Equal([]PaletteColor{{Color: red, Coverage: 1}}, palette(img, img.Bounds(), 5))
+
+	// a small second color must not split the dominant one into duplicates
+	draw.Draw(img, image.Rect(0, 0, 40, 4), image.NewUniform(white), image.Point{}, draw.Src)
+	assert.Equal([]PaletteColor{{Color: red, Coverage: 0.9}, {Color: white, Coverage: 0.1}}, palette(img, img.Bounds(), 4))
+
+	// colors a step apart are one color
+	for x := 0; x < 40; x += 2 {
+		draw.Draw(img, image.Rect(x, 0, x+1, 40), image.NewUniform(color.RGBA{201, 31, 30, 255}), image.Point{}, draw.Src)
+	}
+	res := palette(img, image.Rect(0, 10, 40, 40), 4)
+	assert.Len(res, 1)
+	assert.Equal(1.0, res[0].Coverage)
+
+	assert.Nil(palette(img, image.Rect(50, 50, 60, 60), 4))
+}
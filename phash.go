@@ -0,0 +1,97 @@
+package cropper
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Hash holds perceptual hashes of an image
+type Hash struct {
+	DHash uint64
+	PHash uint64
+}
+
+// DHash returns the difference hash of img, each bit tells whether the luminance increases
+// between horizontally adjacent pixels of a 9x8 thumbnail
+func DHash(img image.Image) uint64 {
+	return dHash(NewDefaultResizer(), img)
+}
+
+// PHash returns the DCT based perceptual hash of img, each bit tells whether a low frequency
+// coefficient of a 32x32 thumbnail is above the median
+func PHash(img image.Image) uint64 {
+	return pHash(NewDefaultResizer(), img)
+}
+
+// HammingDistance returns the number of differing bits between two hashes, similar images
+// differ by only a few bits
+func HammingDistance(h1, h2 uint64) int {
+	return bits.OnesCount64(h1 ^ h2)
+}
+
+func hash(r Resizer, img image.Image) Hash {
+	return Hash{DHash: dHash(r, img), PHash: pHash(r, img)}
+}
+
+func dHash(r Resizer, img image.Image) uint64 {
+	lum := thumbnailLuminance(r, img, 9, 8)
+	var h uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			h <<= 1
+			if lum[y*9+x] < lum[y*9+x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+func pHash(r Resizer, img image.Image) uint64 {
+	const size, low = 32, 8
+	lum := thumbnailLuminance(r, img, size, size)
+
+	// 2D DCT-II, only the low frequencies are needed
+	coeffs := make([]float64, low*low)
+	for v := 0; v < low; v++ {
+		for u := 0; u < low; u++ {
+			sum := 0.0
+			for y := 0; y < size; y++ {
+				cy := math.Cos(float64(2*y+1) * float64(v) * math.Pi / (2 * size))
+				for x := 0; x < size; x++ {
+					sum += lum[y*size+x] * cy * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*size))
+				}
+			}
+			coeffs[v*low+u] = sum
+		}
+	}
+
+	// the DC coefficient only reflects the average brightness and is left out of the median
+	sorted := append([]float64{}, coeffs[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var h uint64
+	for _, c := range coeffs {
+		h <<= 1
+		if c > median {
+			h |= 1
+		}
+	}
+	return h
+}
+
+// thumbnailLuminance resizes img to exactly width x height and returns its luminance
+func thumbnailLuminance(r Resizer, img image.Image, width, height int) []float64 {
+	thumb := toRGBA(r.Resize(img, uint(width), uint(height)))
+	lum := make([]float64, 0, width*height)
+	b := thumb.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			lum = append(lum, cie(thumb.RGBAAt(x, y)))
+		}
+	}
+	return lum
+}
@@ -0,0 +1,34 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gradient(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*255/width + y*128/height) % 256)
+			img.SetRGBA(x, y, color.RGBA{v, 255 - v, uint8(x * y % 256), 255})
+		}
+	}
+	return img
+}
+
+func TestHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	img := gradient(320, 240)
+	resized := NewDefaultResizer().Resize(img, 160, 120)
+	other := letterboxed(320, 240, image.Rect(0, 0, 320, 240))
+
+	assert.True(HammingDistance(DHash(img), DHash(resized)) <= 4)
+	assert.True(HammingDistance(PHash(img), PHash(resized)) <= 4)
+	assert.True(HammingDistance(PHash(img), PHash(other)) > 10)
+	assert.Equal(0, HammingDistance(42, 42))
+	assert.Equal(3, HammingDistance(0, 7))
+}
@@ -0,0 +1,180 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// FindProductCrop frames a single object photographed on a plain background. The background
+// color is estimated from the image borders, the crop is centered on the bounding box of
+// everything that differs from it and grown by padding (a ratio of the object size) on each
+// side before being fitted to the requested aspect ratio. Images without a clean background
+// are handed to the standard analyzer.
+func (a analyzer) FindProductCrop(img image.Image, width, height int, padding float64) (Result, error) {
+	if width == 0 && height == 0 {
+		return Result{}, ErrInvalidDimensions
+	}
+
+	lowimg, _, prescalefactor := a.prescale(img)
+
+	bg, ok := estimateBackground(lowimg)
+	if !ok {
+		if a.debug {
+			a.logger.Infoln("no clean background found, using the standard analyzer")
+		}
+		return a.Analyze(img, width, height, Options{})
+	}
+
+	fg := foregroundBounds(lowimg, bg)
+	b := lowimg.Bounds()
+	if fg.Empty() || (float64(fg.Dx()) > float64(b.Dx())*productMaxSubject && float64(fg.Dy()) > float64(b.Dy())*productMaxSubject) {
+		if a.debug {
+			a.logger.Infof("no object found on background %v, using the standard analyzer", bg)
+		}
+		return a.Analyze(img, width, height, Options{})
+	}
+
+	subject := scaleRect(fg, prescalefactor).Intersect(img.Bounds())
+	if a.debug {
+		a.logger.Infof("background: %v, subject: %v", bg, subject)
+	}
+
+	res := Result{
+		Bounds:     img.Bounds(),
+		Width:      width,
+		Height:     height,
+		Content:    img.Bounds(),
+		Subject:    subject,
+		Background: bg,
+	}
+	frame, ok := frameSubject(subject, img.Bounds(), width, height, padding)
+	if !ok {
+		// no crop of the requested aspect ratio holds the whole subject, letterbox instead
+		layout := containLayout(img.Bounds(), width, height)
+		res.Crop, res.Layout = layout.Crop, &layout
+		if a.debug {
+			a.logger.Infof("subject %v does not fit %dx%d, containing in %v", subject, width, height, layout.Placement)
+		}
+		return res, nil
+	}
+	res.Crop = frame
+	return res, nil
+}
+
+// estimateBackground returns the median color of the outer productBorder frame of img and
+// whether enough of the frame is close to it to be considered a plain background
+func estimateBackground(img *image.RGBA) (color.RGBA, bool) {
+	b := img.Bounds()
+	frame := int(math.Max(1, math.Min(float64(b.Dx()), float64(b.Dy()))*productBorder))
+	inner := b.Inset(frame)
+
+	var rs, gs, bs []int
+	var samples []color.RGBA
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if (image.Point{x, y}).In(inner) {
+				continue
+			}
+			c := img.RGBAAt(x, y)
+			rs = append(rs, int(c.R))
+			gs = append(gs, int(c.G))
+			bs = append(bs, int(c.B))
+			samples = append(samples, c)
+		}
+	}
+	if len(samples) == 0 {
+		return color.RGBA{}, false
+	}
+
+	bg := color.RGBA{uint8(median(rs)), uint8(median(gs)), uint8(median(bs)), 255}
+	matching := 0
+	for _, c := range samples {
+		if colorDistance(c, bg) <= productTolerance {
+			matching++
+		}
+	}
+
+	return bg, float64(matching) >= float64(len(samples))*productCoverage
+}
+
+// foregroundBounds returns the bounding box of the rows and columns where more than
+// productNoise of the pixels differ from bg
+func foregroundBounds(img *image.RGBA, bg color.RGBA) image.Rectangle {
+	b := img.Bounds()
+	rows := make([]int, b.Dy())
+	cols := make([]int, b.Dx())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if colorDistance(img.RGBAAt(x, y), bg) > productTolerance {
+				rows[y-b.Min.Y]++
+				cols[x-b.Min.X]++
+			}
+		}
+	}
+
+	top, bottom := span(rows, int(float64(b.Dx())*productNoise))
+	left, right := span(cols, int(float64(b.Dy())*productNoise))
+	if top >= bottom || left >= right {
+		return image.Rectangle{}
+	}
+	return image.Rect(b.Min.X+left, b.Min.Y+top, b.Min.X+right, b.Min.Y+bottom)
+}
+
+// span returns the first and one past the last index with a count above threshold
+func span(counts []int, threshold int) (int, int) {
+	first, last := -1, -1
+	for i, c := range counts {
+		if c > threshold {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	return first, last + 1
+}
+
+// frameSubject returns a rectangle within bounds containing subject, padded by padding
+// (a ratio of the subject size) on each side and widened to the aspect ratio of width x
+// height. Padding is given up before any of the subject would be cut, if even the unpadded
+// subject does not fit bounds at that aspect ratio frameSubject returns false.
+func frameSubject(subject, bounds image.Rectangle, width, height int, padding float64) (image.Rectangle, bool) {
+	bw, bh := float64(bounds.Dx()), float64(bounds.Dy())
+	minW, minH := aspectFrame(float64(subject.Dx()), float64(subject.Dy()), width, height)
+	if minW > bw || minH > bh {
+		return image.Rectangle{}, false
+	}
+
+	w, h := aspectFrame(float64(subject.Dx())*(1.0+2.0*padding), float64(subject.Dy())*(1.0+2.0*padding), width, height)
+	if f := math.Min(bw/w, bh/h); f < 1.0 {
+		w, h = math.Max(w*f, minW), math.Max(h*f, minH)
+	}
+
+	cx := float64(subject.Min.X+subject.Max.X) / 2.0
+	cy := float64(subject.Min.Y+subject.Max.Y) / 2.0
+	x := math.Min(math.Max(cx-w/2.0, float64(bounds.Min.X)), float64(bounds.Max.X)-w)
+	y := math.Min(math.Max(cy-h/2.0, float64(bounds.Min.Y)), float64(bounds.Max.Y)-h)
+
+	r := image.Rect(int(math.Floor(x)), int(math.Floor(y)), int(math.Ceil(x+w)), int(math.Ceil(y+h)))
+	// rounding must never cost a row or column of the subject
+	return r.Intersect(bounds).Union(subject.Intersect(bounds)), true
+}
+
+// aspectFrame grows w x h to the aspect ratio of width x height, unless one of them is zero
+func aspectFrame(w, h float64, width, height int) (float64, float64) {
+	if width <= 0 || height <= 0 {
+		return w, h
+	}
+	ratio := float64(width) / float64(height)
+	if w/h < ratio {
+		return h * ratio, h
+	}
+	return w, w / ratio
+}
+
+func median(values []int) int {
+	sort.Ints(values)
+	return values[len(values)/2]
+}
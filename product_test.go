@@ -0,0 +1,75 @@
+package cropper
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindProductCrop(t *testing.T) {
+	assert := assert.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	object := image.Rect(500, 200, 700, 400)
+	draw.Draw(img, object, image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+
+	analyzer := NewAnalyzer(Config{})
+	res, err := analyzer.FindProductCrop(img, 300, 300, 0.1)
+	assert.NoError(err)
+	assert.True(object.In(res.Subject.Inset(-4)), "subject %v does not cover %v", res.Subject, object)
+	assert.True(object.In(res.Crop), "crop %v cuts %v", res.Crop, object)
+	assert.True(res.Crop.In(img.Bounds()))
+	assert.InDelta(1.0, float64(res.Crop.Dx())/float64(res.Crop.Dy()), 0.02)
+}
+
+func TestFindProductCropFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	img := letterboxed(400, 300, image.Rect(0, 0, 400, 300))
+	analyzer := NewAnalyzer(Config{})
+	res, err := analyzer.FindProductCrop(img, 100, 100, 0.1)
+	assert.NoError(err)
+	assert.True(res.Subject.Empty())
+	assert.False(res.Crop.Empty())
+}
+
+func TestFindProductCropKeepsSubject(t *testing.T) {
+	assert := assert.New(t)
+
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	object := image.Rect(100, 250, 660, 350)
+	draw.Draw(img, object, image.NewUniform(color.RGBA{200, 30, 30, 255}), image.Point{}, draw.Src)
+	analyzer := NewAnalyzer(Config{})
+
+	// the padding gets dropped before the square frame would cut the subject
+	res, err := analyzer.FindProductCrop(img, 300, 300, 0.2)
+	assert.NoError(err)
+	assert.Nil(res.Layout)
+	assert.True(object.In(res.Crop), "crop %v cuts %v", res.Crop, object)
+	assert.True(res.Crop.In(img.Bounds()))
+	assert.InDelta(1.0, float64(res.Crop.Dx())/float64(res.Crop.Dy()), 0.02)
+
+	// a wide subject cannot be framed tall, the whole image gets letterboxed instead
+	res, err = analyzer.FindProductCrop(img, 300, 600, 0.1)
+	assert.NoError(err)
+	assert.NotNil(res.Layout)
+	assert.Equal(img.Bounds(), res.Crop)
+	assert.True(res.Layout.Padded)
+	assert.Equal(image.Rect(0, 0, 300, 600), res.Layout.Canvas)
+	assert.Equal(image.Rect(0, 187, 300, 412), res.Layout.Placement)
+
+	enc, _ := NewEncoder(EncoderOptions{Format: "png"})
+	var buf bytes.Buffer
+	assert.NoError(analyzer.(Codec).WriteResult(&buf, img, res, enc))
+	out, _, err := image.Decode(&buf)
+	assert.NoError(err)
+	assert.Equal(image.Rect(0, 0, 300, 600), out.Bounds())
+	r, g, b, _ := out.At(150, 10).RGBA()
+	assert.Equal([3]uint32{0xffff, 0xffff, 0xffff}, [3]uint32{r, g, b}, "padding is not the background color")
+}
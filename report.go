@@ -0,0 +1,50 @@
+package cropper
+
+import "image"
+
+// Rect is a rectangle in the JSON form used by reports and faces files
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// NewRect converts r to a Rect
+func NewRect(r image.Rectangle) Rect {
+	return Rect{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}
+}
+
+// Rectangle converts r to an image.Rectangle
+func (r Rect) Rectangle() image.Rectangle {
+	return image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height)
+}
+
+// Point is a point in the JSON form used by reports
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// Report is the JSON summary of a Result
+type Report struct {
+	Crop       Rect   `json:"crop"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Score      Score  `json:"score"`
+	FocalPoint Point  `json:"focal_point"`
+	Format     string `json:"format,omitempty"`
+}
+
+// Report returns the JSON summary of the result
+func (r Result) Report() Report {
+	fp := r.FocalPoint()
+	return Report{
+		Crop:       NewRect(r.Crop),
+		Width:      r.Width,
+		Height:     r.Height,
+		Score:      r.Score,
+		FocalPoint: Point{X: fp.X, Y: fp.Y},
+		Format:     r.Format,
+	}
+}
@@ -0,0 +1,180 @@
+package cropper
+
+import (
+	"image"
+	"math"
+	"math/cmplx"
+)
+
+// saliencyDetect implements the spectral residual approach by Hou and Zhang: the log
+// amplitude spectrum of the luminance is compared to its local average and whatever stands
+// out is transformed back to the spatial domain. The analysis runs on a saliencySize square
+// thumbnail and the result is scaled back up to width x height.
+func saliencyDetect(cies []float64, width, height int) *image.Gray {
+	o := image.NewGray(image.Rect(0, 0, width, height))
+	if width == 0 || height == 0 {
+		return o
+	}
+
+	// downsample the luminance by averaging blocks
+	n := saliencySize
+	spectrum := make([]complex128, n*n)
+	for sy := 0; sy < n; sy++ {
+		y0, y1 := sy*height/n, (sy+1)*height/n
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for sx := 0; sx < n; sx++ {
+			x0, x1 := sx*width/n, (sx+1)*width/n
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			sum, count := 0.0, 0.0
+			for y := y0; y < y1 && y < height; y++ {
+				for x := x0; x < x1 && x < width; x++ {
+					sum += cies[y*width+x]
+					count++
+				}
+			}
+			if count > 0 {
+				spectrum[sy*n+sx] = complex(sum/count, 0)
+			}
+		}
+	}
+
+	fft2(spectrum, n, false)
+
+	// log(1+|c|) keeps near zero frequencies next to a few strong ones, common for flat
+	// backgrounds, from getting an enormous residual
+	amplitude := make([]float64, n*n)
+	for k, c := range spectrum {
+		amplitude[k] = math.Log(cmplx.Abs(c) + 1)
+	}
+	average := boxBlur(amplitude, n, 1)
+	for k, c := range spectrum {
+		spectrum[k] = cmplx.Rect(math.Exp(amplitude[k]-average[k]), cmplx.Phase(c))
+	}
+
+	fft2(spectrum, n, true)
+
+	sal := make([]float64, n*n)
+	for k, c := range spectrum {
+		a := cmplx.Abs(c)
+		sal[k] = a * a
+	}
+	for p := 0; p < saliencyBlurPasses; p++ {
+		sal = boxBlur(sal, n, 1)
+	}
+
+	maxSal := 0.0
+	for _, v := range sal {
+		maxSal = math.Max(maxSal, v)
+	}
+	if maxSal == 0 {
+		return o
+	}
+
+	// bilinear upsampling to the analyzed image size
+	for y := 0; y < height; y++ {
+		fy := math.Max(0, (float64(y)+0.5)*float64(n)/float64(height)-0.5)
+		y0 := int(fy)
+		y1 := y0 + 1
+		if y1 >= n {
+			y1 = n - 1
+		}
+		wy := fy - float64(y0)
+		for x := 0; x < width; x++ {
+			fx := math.Max(0, (float64(x)+0.5)*float64(n)/float64(width)-0.5)
+			x0 := int(fx)
+			x1 := x0 + 1
+			if x1 >= n {
+				x1 = n - 1
+			}
+			wx := fx - float64(x0)
+			v := (sal[y0*n+x0]*(1-wx)+sal[y0*n+x1]*wx)*(1-wy) + (sal[y1*n+x0]*(1-wx)+sal[y1*n+x1]*wx)*wy
+			o.Pix[y*o.Stride+x] = uint8(bounds(v / maxSal * 255.0))
+		}
+	}
+
+	return o
+}
+
+// boxBlur averages every value of the n x n grid with its neighbors within radius,
+// clamping at the borders
+func boxBlur(values []float64, n, radius int) []float64 {
+	out := make([]float64, len(values))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			sum, count := 0.0, 0.0
+			for dy := -radius; dy <= radius; dy++ {
+				for dx := -radius; dx <= radius; dx++ {
+					yy, xx := y+dy, x+dx
+					if yy < 0 || yy >= n || xx < 0 || xx >= n {
+						continue
+					}
+					sum += values[yy*n+xx]
+					count++
+				}
+			}
+			out[y*n+x] = sum / count
+		}
+	}
+	return out
+}
+
+// fft2 transforms the n x n grid in place, n must be a power of two
+func fft2(values []complex128, n int, inverse bool) {
+	line := make([]complex128, n)
+	for y := 0; y < n; y++ {
+		fft(values[y*n:(y+1)*n], inverse)
+	}
+	for x := 0; x < n; x++ {
+		for y := 0; y < n; y++ {
+			line[y] = values[y*n+x]
+		}
+		fft(line, inverse)
+		for y := 0; y < n; y++ {
+			values[y*n+x] = line[y]
+		}
+	}
+}
+
+// fft is an iterative radix-2 Cooley-Tukey transform, the inverse is scaled by 1/n
+func fft(values []complex128, inverse bool) {
+	n := len(values)
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			values[i], values[j] = values[j], values[i]
+		}
+	}
+
+	sign := -1.0
+	if inverse {
+		sign = 1.0
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			t := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := values[start+k]
+				v := values[start+k+size/2] * t
+				values[start+k] = u + v
+				values[start+k+size/2] = u - v
+				t *= w
+			}
+		}
+	}
+
+	if inverse {
+		for i := range values {
+			values[i] /= complex(float64(n), 0)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package cropper
+
+import (
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaliencyDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	// one bright blob on a flat background
+	width, height := 300, 200
+	cies := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			cies[y*width+x] = 100
+			if x >= 200 && x < 230 && y >= 40 && y < 70 {
+				cies[y*width+x] = 250
+			}
+		}
+	}
+
+	o := saliencyDetect(cies, width, height)
+	// spectral residual mostly highlights the outline of larger objects
+	var blob uint8
+	for y := 40; y < 70; y++ {
+		for x := 200; x < 230; x++ {
+			if v := o.GrayAt(x, y).Y; v > blob {
+				blob = v
+			}
+		}
+	}
+	assert.True(blob > 200, "blob scored %d", blob)
+	for _, p := range [][2]int{{20, 20}, {20, 180}, {80, 150}, {280, 180}} {
+		assert.True(o.GrayAt(p[0], p[1]).Y < blob/4, "background at %v scored %d", p, o.GrayAt(p[0], p[1]).Y)
+	}
+
+	// the brightest spot lies on the blob
+	var bx, by int
+	var best uint8
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if v := o.GrayAt(x, y).Y; v > best {
+				best, bx, by = v, x, y
+			}
+		}
+	}
+	assert.InDelta(215, bx, 25)
+	assert.InDelta(55, by, 25)
+}
+
+func TestFFTRoundTrip(t *testing.T) {
+	n := 8
+	data := make([]complex128, n*n)
+	for k := range data {
+		data[k] = complex(float64(k%5), float64(k%3))
+	}
+	orig := append([]complex128{}, data...)
+
+	fft2(data, n, false)
+	fft2(data, n, true)
+	for k := range data {
+		assert.InDelta(t, 0, cmplx.Abs(data[k]-orig[k]), 1e-9)
+	}
+}
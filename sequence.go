@@ -0,0 +1,183 @@
+package cropper
+
+import (
+	"image"
+	"io"
+	"math"
+)
+
+// FrameIterator yields the frames of a video, Next returns io.EOF after the last frame
+type FrameIterator interface {
+	Next() (image.Image, error)
+}
+
+// SequenceOptions control the temporal smoothing of FindCropPath
+type SequenceOptions struct {
+	// MovePenalty is the cost of moving the crop by its own size between two frames,
+	// measured against per frame crop scores normalized to 0-1. Zero means
+	// sequenceMovePenalty, higher values give steadier paths.
+	MovePenalty float64
+	// SceneCutThreshold is the luminance histogram difference (0-1) between two frames
+	// above which a scene cut is assumed and the crop may jump freely. Zero means
+	// sceneCutThreshold.
+	SceneCutThreshold float64
+}
+
+// FindCropPath returns one crop per frame for a sequence of equally sized frames. Every
+// frame scores the same set of fixed size candidates, then dynamic programming picks the
+// path maximizing the total score minus a penalty for moving the crop between frames. The
+// penalty is waived across detected scene cuts.
+func (a analyzer) FindCropPath(frames FrameIterator, width, height int, opts SequenceOptions) ([]image.Rectangle, error) {
+	if width == 0 && height == 0 {
+		return nil, ErrInvalidDimensions
+	}
+	penalty := opts.MovePenalty
+	if penalty <= 0 {
+		penalty = sequenceMovePenalty
+	}
+	threshold := opts.SceneCutThreshold
+	if threshold <= 0 {
+		threshold = sceneCutThreshold
+	}
+
+	var (
+		bounds         image.Rectangle
+		prescalefactor float64
+		s              search
+		candidates     []Crop
+		prevHist       []float64
+		cost           []float64
+		back           [][]int
+	)
+
+	for n := 0; ; n++ {
+		frame, err := frames.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if n == 0 {
+			bounds = frame.Bounds()
+		} else if frame.Bounds().Size() != bounds.Size() {
+			return nil, ErrFrameSize
+		}
+
+		lowimg, cies, f := a.prescale(frame)
+		if n == 0 {
+			prescalefactor = f
+			s = a.newSearch(width, height, float64(bounds.Dx()), float64(bounds.Dy()), f, lowimg.Bounds(), Options{})
+			// the crop size stays fixed so only its position changes over time
+			candidates = crops(s.content, s.cropWidth, s.cropHeight, maxScale)
+			if len(candidates) == 0 {
+				return nil, ErrInvalidDimensions
+			}
+		}
+
+		o := a.detect(lowimg, cies)
+		scores := make([]float64, len(candidates))
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i, crop := range candidates {
+			crop.Score = score(o, crop, s.composition)
+			scores[i] = crop.totalScore()
+			lo, hi = math.Min(lo, scores[i]), math.Max(hi, scores[i])
+		}
+		for i := range scores {
+			if hi > lo {
+				scores[i] = (scores[i] - lo) / (hi - lo)
+			} else {
+				scores[i] = 0
+			}
+		}
+
+		hist := luminanceHistogram(cies)
+		cut := prevHist != nil && histogramDistance(prevHist, hist) > threshold
+		prevHist = hist
+		if cut && a.debug {
+			a.logger.Infof("scene cut at frame %d", n)
+		}
+
+		if cost == nil {
+			cost = make([]float64, len(candidates))
+			for i := range scores {
+				cost[i] = -scores[i]
+			}
+			back = append(back, nil)
+			continue
+		}
+
+		next := make([]float64, len(candidates))
+		from := make([]int, len(candidates))
+		for i, c := range candidates {
+			best, bestIdx := math.Inf(1), 0
+			for j, p := range candidates {
+				v := cost[j]
+				if !cut {
+					v += penalty * moveDistance(p, c)
+				}
+				if v < best {
+					best, bestIdx = v, j
+				}
+			}
+			next[i] = best - scores[i]
+			from[i] = bestIdx
+		}
+		cost = next
+		back = append(back, from)
+	}
+
+	if cost == nil {
+		return nil, nil
+	}
+
+	// walk the cheapest path backwards
+	idx := 0
+	for i := range cost {
+		if cost[i] < cost[idx] {
+			idx = i
+		}
+	}
+	path := make([]image.Rectangle, len(back))
+	for n := len(back) - 1; n >= 0; n-- {
+		path[n] = scaleRect(candidates[idx].Rectangle, prescalefactor).Add(bounds.Min)
+		if back[n] != nil {
+			idx = back[n][idx]
+		}
+	}
+
+	return path, nil
+}
+
+// moveDistance measures how far the crop moves between p and c relative to its size
+func moveDistance(p, c Crop) float64 {
+	dx := float64(c.Min.X-p.Min.X) / float64(c.Dx())
+	dy := float64(c.Min.Y-p.Min.Y) / float64(c.Dy())
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// luminanceHistogram returns the normalized histogram of the luminance cies
+func luminanceHistogram(cies []float64) []float64 {
+	hist := make([]float64, sceneHistogramBins)
+	for _, c := range cies {
+		b := int(c / cieMax * sceneHistogramBins)
+		if b >= sceneHistogramBins {
+			b = sceneHistogramBins - 1
+		}
+		hist[b]++
+	}
+	for i := range hist {
+		hist[i] /= float64(len(cies))
+	}
+	return hist
+}
+
+// histogramDistance returns the total variation distance (0-1) between two histograms
+func histogramDistance(h1, h2 []float64) float64 {
+	d := 0.0
+	for i := range h1 {
+		d += math.Abs(h1[i] - h2[i])
+	}
+	return d / 2
+}
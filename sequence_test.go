@@ -0,0 +1,92 @@
+package cropper
+
+import (
+	"image"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sliceFrames iterates over a slice of frames
+type sliceFrames []image.Image
+
+func (f *sliceFrames) Next() (image.Image, error) {
+	if len(*f) == 0 {
+		return nil, io.EOF
+	}
+	frame := (*f)[0]
+	*f = (*f)[1:]
+	return frame, nil
+}
+
+// movingSubject returns a 300x100 frame with a saturated checkerboard at x on a gray of
+// the given level
+func movingSubject(x int, level uint8) image.Image {
+	img := smallSubject(300, 100, image.Rect(x, 20, x+60, 80))
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i] == 128 && img.Pix[i+1] == 128 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = level, level, level
+		}
+	}
+	return img
+}
+
+func TestFindCropPath(t *testing.T) {
+	assert := assert.New(t)
+	analyzer := NewAnalyzer(Config{})
+
+	// the subject flickers between two spots, per frame crops would jump every frame
+	var frames sliceFrames
+	for i := 0; i < 6; i++ {
+		frames = append(frames, movingSubject(20+160*(i%2), 128))
+	}
+	flicker := append(sliceFrames{}, frames...)
+	path, err := analyzer.FindCropPath(&flicker, 100, 100, SequenceOptions{})
+	assert.NoError(err)
+	assert.Len(path, 6)
+	for i, r := range path {
+		assert.Equal(image.Rect(0, 0, 100, 100), r.Sub(r.Min), "frame %d", i)
+		assert.Equal(path[0], r, "crop moved at frame %d", i)
+	}
+
+	// without a penalty the path follows the subject
+	flicker = append(sliceFrames{}, frames...)
+	path, err = analyzer.FindCropPath(&flicker, 100, 100, SequenceOptions{MovePenalty: 1e-9})
+	assert.NoError(err)
+	for i, r := range path {
+		subject := image.Rect(20+160*(i%2), 20, 80+160*(i%2), 80)
+		assert.True(r.Overlaps(subject), "frame %d crop %v misses %v", i, r, subject)
+	}
+
+	// a slowly moving subject gets followed in steps that never jump
+	frames = nil
+	for i := 0; i < 8; i++ {
+		frames = append(frames, movingSubject(20+20*i, 128))
+	}
+	path, err = analyzer.FindCropPath(&frames, 100, 100, SequenceOptions{})
+	assert.NoError(err)
+	assert.Len(path, 8)
+	for i := 1; i < len(path); i++ {
+		step := path[i].Min.X - path[i-1].Min.X
+		assert.True(step >= 0 && step <= 40, "crop jumped %d pixels at frame %d", step, i)
+	}
+	assert.True(path[len(path)-1].Min.X > path[0].Min.X, "crop %v did not follow the subject", path)
+
+	// a scene cut lets the crop jump despite a high penalty
+	frames = sliceFrames{movingSubject(20, 128), movingSubject(20, 128), movingSubject(220, 10), movingSubject(220, 10)}
+	path, err = analyzer.FindCropPath(&frames, 100, 100, SequenceOptions{MovePenalty: 100})
+	assert.NoError(err)
+	assert.True(path[1].In(image.Rect(0, 0, 150, 100)), "crop %v before the cut", path[1])
+	assert.True(path[2].In(image.Rect(150, 0, 300, 100)), "crop %v after the cut", path[2])
+	assert.Equal(path[2], path[3])
+
+	frames = sliceFrames{movingSubject(20, 128), image.NewRGBA(image.Rect(0, 0, 10, 10))}
+	_, err = analyzer.FindCropPath(&frames, 100, 100, SequenceOptions{})
+	assert.Equal(ErrFrameSize, err)
+
+	frames = nil
+	path, err = analyzer.FindCropPath(&frames, 100, 100, SequenceOptions{})
+	assert.NoError(err)
+	assert.Empty(path)
+}
@@ -0,0 +1,181 @@
+package cropper
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SizeSpec describes a requested output size relative to the source image
+type SizeSpec struct {
+	// Width and Height are the output size in pixels, one of them may be zero to keep
+	// the aspect ratio of the source
+	Width  int
+	Height int
+	// AspectX and AspectY request the largest crop with that aspect ratio, e.g. 16:9
+	AspectX int
+	AspectY int
+	// Percent scales the source by the given percentage without cropping
+	Percent float64
+	// Shrink fits the source within Width x Height keeping its aspect ratio and never
+	// enlarges it, like ImageMagick's "WxH>" geometry
+	Shrink bool
+}
+
+// SizeSpecError gets returned when a size spec cannot be parsed
+type SizeSpecError struct {
+	Spec string
+}
+
+func (e *SizeSpecError) Error() string {
+	return fmt.Sprintf("%s: %q", ErrInvalidSizeSpec, e.Spec)
+}
+
+func (e *SizeSpecError) Unwrap() error {
+	return ErrInvalidSizeSpec
+}
+
+// ParseSizeSpec parses exact sizes ("300x200"), aspect ratios ("16:9"), a single
+// dimension ("300x", "x200"), percentages ("50%") and max bounds ("300x300>")
+func ParseSizeSpec(spec string) (SizeSpec, error) {
+	s := strings.TrimSpace(spec)
+	invalid := &SizeSpecError{Spec: spec}
+
+	switch {
+	case strings.HasSuffix(s, "%"):
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || !(p > 0) || math.IsInf(p, 0) {
+			return SizeSpec{}, invalid
+		}
+		return SizeSpec{Percent: p}, nil
+
+	case strings.Contains(s, ":"):
+		parts := strings.SplitN(s, ":", 2)
+		x, errX := strconv.Atoi(parts[0])
+		y, errY := strconv.Atoi(parts[1])
+		if errX != nil || errY != nil || x <= 0 || y <= 0 {
+			return SizeSpec{}, invalid
+		}
+		return SizeSpec{AspectX: x, AspectY: y}, nil
+	}
+
+	var size SizeSpec
+	if strings.HasSuffix(s, ">") {
+		size.Shrink = true
+		s = strings.TrimSuffix(s, ">")
+	}
+	parts := strings.Split(strings.ToLower(s), "x")
+	if len(parts) != 2 {
+		return SizeSpec{}, invalid
+	}
+	var err error
+	if parts[0] != "" {
+		if size.Width, err = strconv.Atoi(parts[0]); err != nil || size.Width <= 0 {
+			return SizeSpec{}, invalid
+		}
+	}
+	if parts[1] != "" {
+		if size.Height, err = strconv.Atoi(parts[1]); err != nil || size.Height <= 0 {
+			return SizeSpec{}, invalid
+		}
+	}
+	if size.Width == 0 && size.Height == 0 || size.Shrink && (size.Width == 0 || size.Height == 0) {
+		return SizeSpec{}, invalid
+	}
+
+	return size, nil
+}
+
+// String formats the spec in the syntax accepted by ParseSizeSpec
+func (s SizeSpec) String() string {
+	switch {
+	case s.Percent > 0:
+		return strconv.FormatFloat(s.Percent, 'f', -1, 64) + "%"
+	case s.AspectX > 0 && s.AspectY > 0:
+		return fmt.Sprintf("%d:%d", s.AspectX, s.AspectY)
+	}
+
+	var w, h string
+	if s.Width > 0 {
+		w = strconv.Itoa(s.Width)
+	}
+	if s.Height > 0 {
+		h = strconv.Itoa(s.Height)
+	}
+	if s.Shrink {
+		return w + "x" + h + ">"
+	}
+	return w + "x" + h
+}
+
+// Resolve returns the output width and height of the spec for a source with the given bounds
+func (s SizeSpec) Resolve(bounds image.Rectangle) (int, int, error) {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	if w <= 0 || h <= 0 {
+		return 0, 0, ErrInvalidDimensions
+	}
+
+	switch {
+	case s.Percent > 0:
+		return atLeastOne(w * s.Percent / 100), atLeastOne(h * s.Percent / 100), nil
+
+	case s.AspectX > 0 && s.AspectY > 0:
+		scale := math.Min(w/float64(s.AspectX), h/float64(s.AspectY))
+		return atLeastOne(float64(s.AspectX) * scale), atLeastOne(float64(s.AspectY) * scale), nil
+
+	case s.Shrink && s.Width > 0 && s.Height > 0:
+		scale := math.Min(1, math.Min(float64(s.Width)/w, float64(s.Height)/h))
+		return atLeastOne(w * scale), atLeastOne(h * scale), nil
+
+	case s.Width > 0 && s.Height > 0:
+		return s.Width, s.Height, nil
+
+	case s.Width > 0:
+		return s.Width, atLeastOne(h * float64(s.Width) / w), nil
+
+	case s.Height > 0:
+		return atLeastOne(w * float64(s.Height) / h), s.Height, nil
+	}
+
+	return 0, 0, ErrInvalidDimensions
+}
+
+func atLeastOne(x float64) int {
+	return int(math.Max(1, math.Round(x)))
+}
+
+// crops is false for specs that scale the whole source, percentages and max bounds
+func (s SizeSpec) crops() bool {
+	return s.Percent <= 0 && !s.Shrink
+}
+
+// AnalyzeSize resolves size against img and analyzes it, percentages and max bounds never
+// crop so their Crop is the whole image
+func (a analyzer) AnalyzeSize(img image.Image, size SizeSpec, opts Options) (Result, error) {
+	width, height, err := size.Resolve(img.Bounds())
+	if err != nil {
+		return Result{}, err
+	}
+	return a.analyzeImage(img, width, height, opts, size.crops())
+}
+
+func (a analyzer) AnalyzeReaderSize(r io.Reader, size SizeSpec, opts Options) (Result, error) {
+	img, format, orientation, err := a.readOriented(r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	b := img.Bounds()
+	if orientation >= 5 {
+		b = image.Rect(0, 0, b.Dy(), b.Dx())
+	}
+	width, height, err := size.Resolve(b)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return a.analyzeOriented(img, format, orientation, width, height, opts, size.crops())
+}
@@ -0,0 +1,78 @@
+package cropper
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSizeSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	bounds := image.Rect(0, 0, 1000, 500)
+	tests := []struct {
+		spec          string
+		size          SizeSpec
+		width, height int
+	}{
+		{"300x200", SizeSpec{Width: 300, Height: 200}, 300, 200},
+		{"16:9", SizeSpec{AspectX: 16, AspectY: 9}, 889, 500},
+		{"300x", SizeSpec{Width: 300}, 300, 150},
+		{"x200", SizeSpec{Height: 200}, 400, 200},
+		{"50%", SizeSpec{Percent: 50}, 500, 250},
+		{"300x300>", SizeSpec{Width: 300, Height: 300, Shrink: true}, 300, 150},
+		{"2000x2000>", SizeSpec{Width: 2000, Height: 2000, Shrink: true}, 1000, 500},
+	}
+	for _, test := range tests {
+		size, err := ParseSizeSpec(test.spec)
+		assert.NoError(err, test.spec)
+		assert.Equal(test.size, size, test.spec)
+		assert.Equal(test.spec, size.String())
+
+		w, h, err := size.Resolve(bounds)
+		assert.NoError(err, test.spec)
+		assert.Equal(test.width, w, test.spec)
+		assert.Equal(test.height, h, test.spec)
+	}
+
+	for _, spec := range []string{"", "x", "0x100", "-5x10", "16:0", "abc", "300x>", "1x2x3", "%", "NaN%", "nan%", "Inf%", "-10%", "0%"} {
+		_, err := ParseSizeSpec(spec)
+		assert.True(errors.Is(err, ErrInvalidSizeSpec), "%q: %v", spec, err)
+	}
+}
+
+func TestAnalyzeSize(t *testing.T) {
+	assert := assert.New(t)
+
+	analyzer := NewAnalyzer(Config{})
+	res, err := analyzer.AnalyzeSize(gradient(400, 200), SizeSpec{AspectX: 1, AspectY: 1}, Options{})
+	assert.NoError(err)
+	assert.Equal(200, res.Width)
+	assert.Equal(200, res.Height)
+	assert.Equal(res.Crop.Dx(), res.Crop.Dy())
+
+	// the spec is resolved against the displayed, rotated bounds
+	data := withOrientation(t, gradient(300, 200), 6)
+	res, err = analyzer.AnalyzeReaderSize(bytes.NewReader(data), SizeSpec{Width: 100}, Options{})
+	assert.NoError(err)
+	assert.Equal(100, res.Width)
+	assert.Equal(150, res.Height)
+
+	// percentages and max bounds scale the whole image
+	img := gradient(400, 200)
+	for _, size := range []SizeSpec{{Percent: 50}, {Width: 100, Height: 100, Shrink: true}} {
+		res, err := analyzer.AnalyzeSize(img, size, Options{Palette: 2})
+		assert.NoError(err)
+		assert.Equal(img.Bounds(), res.Crop, "%v", size)
+		assert.Equal(res.Bounds, res.Crop, "%v", size)
+		assert.NotEmpty(res.Palette)
+
+		res, err = analyzer.AnalyzeReaderSize(bytes.NewReader(data), size, Options{})
+		assert.NoError(err)
+		assert.Equal(image.Rect(0, 0, 200, 300), res.Crop, "%v", size)
+		assert.Equal(image.Rect(0, 0, 300, 200), res.RawCrop, "%v", size)
+	}
+}
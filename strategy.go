@@ -0,0 +1,183 @@
+package cropper
+
+import (
+	"image"
+	"math"
+	"time"
+)
+
+// Strategy selects how the analyzer picks a crop, the set mirrors the interesting
+// strategies of libvips smartcrop. Every strategy keeps Options.Faces in the crop when
+// they fit.
+type Strategy int
+
+const (
+	// StrategyAttention scores crops by edges, skin and saturation (and the optional
+	// detectors), this is the default
+	StrategyAttention Strategy = iota
+	// StrategyEntropy picks the crop with the most information measured as the entropy of
+	// the luminance histogram in small windows
+	StrategyEntropy
+	// StrategyCentre crops the center of the image
+	StrategyCentre
+	// StrategyLow crops the top left of the image
+	StrategyLow
+	// StrategyHigh crops the bottom right of the image
+	StrategyHigh
+)
+
+// fixedCrop returns the largest crop anchored as requested by the trivial strategies
+func fixedCrop(s search, strategy Strategy) Crop {
+	cw, ch := cropSize(s)
+	c := s.content
+	var x, y int
+	switch strategy {
+	case StrategyCentre:
+		x = c.Min.X + (c.Dx()-cw)/2
+		y = c.Min.Y + (c.Dy()-ch)/2
+	case StrategyHigh:
+		x = c.Max.X - cw
+		y = c.Max.Y - ch
+	default:
+		x = c.Min.X
+		y = c.Min.Y
+	}
+	return Crop{Rectangle: image.Rect(x, y, x+cw, y+ch)}
+}
+
+// cropSize returns the size of the largest crop considered by the search
+func cropSize(s search) (int, int) {
+	minDimension := math.Min(float64(s.content.Dx()), float64(s.content.Dy()))
+	cw, ch := s.cropWidth, s.cropHeight
+	if cw == 0.0 || math.IsNaN(cw) {
+		cw = minDimension
+	}
+	if ch == 0.0 || math.IsNaN(ch) {
+		ch = minDimension
+	}
+	return int(math.Min(cw, float64(s.content.Dx()))), int(math.Min(ch, float64(s.content.Dy())))
+}
+
+// analyzeEntropy returns the candidate crop with the most entropy per pixel, only crops
+// containing faces are considered when any fit
+func (a analyzer) analyzeEntropy(img *image.RGBA, cies []float64, s search, faces image.Rectangle) Crop {
+	now := time.Now()
+	e := entropyDetect(cies, img.Bounds().Dx(), img.Bounds().Dy())
+	if a.debug {
+		a.logger.Infoln("Time elapsed entropy:", time.Since(now))
+		writeImage("png", e, "./cropper_entropy.png")
+	}
+
+	// summed area table for constant time sums over each candidate
+	width, height := e.Bounds().Dx(), e.Bounds().Dy()
+	sat := make([]float64, (width+1)*(height+1))
+	for y := 0; y < height; y++ {
+		row := 0.0
+		for x := 0; x < width; x++ {
+			row += float64(e.Pix[y*e.Stride+x]) / 255.0
+			sat[(y+1)*(width+1)+x+1] = sat[y*(width+1)+x+1] + row
+		}
+	}
+	sum := func(r image.Rectangle) float64 {
+		r = r.Intersect(e.Bounds())
+		return sat[r.Max.Y*(width+1)+r.Max.X] - sat[r.Min.Y*(width+1)+r.Max.X] -
+			sat[r.Max.Y*(width+1)+r.Min.X] + sat[r.Min.Y*(width+1)+r.Min.X]
+	}
+
+	var topCrop, topFaces Crop
+	topScore, topFacesScore := -1.0, -1.0
+	for _, crop := range crops(s.content, s.cropWidth, s.cropHeight, s.realMinScale) {
+		if crop.Empty() {
+			continue
+		}
+		crop.Score.Entropy = sum(crop.Rectangle) / float64(crop.Dx()*crop.Dy())
+		score := crop.Score.Entropy * (1 - crop.zoom*zoomWeight)
+		if score > topScore {
+			topCrop, topScore = crop, score
+		}
+		if faces.In(crop.Rectangle) && score > topFacesScore {
+			topFaces, topFacesScore = crop, score
+		}
+	}
+	switch {
+	case topFacesScore >= 0:
+		return topFaces
+	case topScore < 0:
+		return Crop{Rectangle: shiftOnto(fixedCrop(s, StrategyCentre).Rectangle, faces, s.content)}
+	}
+	topCrop.Rectangle = shiftOnto(topCrop.Rectangle, faces, s.content)
+	return topCrop
+}
+
+// shiftOnto moves r the least distance so that it covers as much of faces as its size
+// allows without leaving content
+func shiftOnto(r, faces, content image.Rectangle) image.Rectangle {
+	if faces.Empty() {
+		return r
+	}
+	shift := func(min, max, fmin, fmax, cmin, cmax int) int {
+		d := 0
+		if max < fmax {
+			d = fmax - max
+		}
+		if min+d > fmin {
+			d = fmin - min
+		}
+		if max+d > cmax {
+			d = cmax - max
+		}
+		if min+d < cmin {
+			d = cmin - min
+		}
+		return d
+	}
+	return r.Add(image.Pt(
+		shift(r.Min.X, r.Max.X, faces.Min.X, faces.Max.X, content.Min.X, content.Max.X),
+		shift(r.Min.Y, r.Max.Y, faces.Min.Y, faces.Max.Y, content.Min.Y, content.Max.Y),
+	))
+}
+
+// entropyDetect computes the Shannon entropy of the luminance histogram over
+// entropyWindow sized windows, scaled so the maximum possible entropy is 255
+func entropyDetect(cies []float64, width, height int) *image.Gray {
+	o := image.NewGray(image.Rect(0, 0, width, height))
+
+	maxEntropy := math.Log2(entropyBins)
+	var hist [entropyBins]float64
+
+	for wy := 0; wy < height; wy += entropyWindow {
+		for wx := 0; wx < width; wx += entropyWindow {
+			for b := range hist {
+				hist[b] = 0
+			}
+			n := 0.0
+			for y := wy; y < wy+entropyWindow && y < height; y++ {
+				for x := wx; x < wx+entropyWindow && x < width; x++ {
+					b := int(cies[y*width+x] / cieMax * entropyBins)
+					if b >= entropyBins {
+						b = entropyBins - 1
+					}
+					hist[b]++
+					n++
+				}
+			}
+
+			entropy := 0.0
+			for _, c := range hist {
+				if c > 0 {
+					p := c / n
+					entropy -= p * math.Log2(p)
+				}
+			}
+
+			v := uint8(bounds(entropy / maxEntropy * 255.0))
+			for y := wy; y < wy+entropyWindow && y < height; y++ {
+				for x := wx; x < wx+entropyWindow && x < width; x++ {
+					o.Pix[y*o.Stride+x] = v
+				}
+			}
+		}
+	}
+
+	return o
+}
@@ -0,0 +1,75 @@
+package cropper
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noisy returns a flat gray image with random noise in r
+func noisy(width, height int, r image.Rectangle) *image.RGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8(128)
+			if (image.Point{x, y}).In(r) {
+				v = uint8(rnd.Intn(256))
+			}
+			img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+func TestFixedStrategies(t *testing.T) {
+	assert := assert.New(t)
+	img := gradient(600, 400)
+	face := image.Rect(520, 100, 580, 160)
+
+	for _, c := range []struct {
+		strategy  Strategy
+		crop      image.Rectangle
+		withFaces image.Rectangle
+	}{
+		{StrategyCentre, image.Rect(100, 0, 500, 400), image.Rect(180, 0, 580, 400)},
+		{StrategyLow, image.Rect(0, 0, 400, 400), image.Rect(180, 0, 580, 400)},
+		{StrategyHigh, image.Rect(200, 0, 600, 400), image.Rect(200, 0, 600, 400)},
+	} {
+		analyzer := NewAnalyzer(Config{Strategy: c.strategy})
+		res, err := analyzer.Analyze(img, 200, 200, Options{})
+		assert.NoError(err)
+		assert.Equal(c.crop, res.Crop, "strategy %d", c.strategy)
+
+		res, err = analyzer.Analyze(img, 200, 200, Options{Faces: []image.Rectangle{face}})
+		assert.NoError(err)
+		assert.Equal(c.withFaces, res.Crop, "strategy %d with faces", c.strategy)
+		assert.True(face.In(res.Crop))
+	}
+}
+
+func TestEntropyStrategy(t *testing.T) {
+	assert := assert.New(t)
+
+	img := noisy(600, 400, image.Rect(300, 0, 600, 400))
+	analyzer := NewAnalyzer(Config{Strategy: StrategyEntropy})
+	res, err := analyzer.Analyze(img, 200, 200, Options{})
+	assert.NoError(err)
+	assert.True(res.Crop.Min.X >= 200, "crop %v is not on the noise", res.Crop)
+
+	face := image.Rect(20, 100, 80, 160)
+	res, err = analyzer.Analyze(img, 200, 200, Options{Faces: []image.Rectangle{face}})
+	assert.NoError(err)
+	assert.True(face.In(res.Crop), "crop %v cuts %v", res.Crop, face)
+
+	// entropy is compared per pixel, so with MinZoom the crop closes in on a small patch
+	patch := image.Rect(400, 200, 520, 320)
+	img = noisy(600, 400, patch)
+	res, err = NewAnalyzer(Config{Strategy: StrategyEntropy, MinZoom: 0.25, MaxUpscale: 4}).Analyze(img, 100, 100, Options{})
+	assert.NoError(err)
+	assert.True(res.Crop.Dx() <= 160, "crop %v did not zoom in", res.Crop)
+	assert.True(res.Crop.Overlaps(patch), "crop %v misses %v", res.Crop, patch)
+}